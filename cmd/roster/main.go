@@ -1,11 +1,23 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/ardnew/roster"
+	"github.com/ardnew/roster/file"
+	"github.com/ardnew/roster/walk"
 	"github.com/ardnew/version"
 )
 
@@ -23,8 +35,32 @@ func init() {
 }
 
 const (
-	rosterFileNameDefault = ".roster.yml"
+	rosterFileNameDefault = roster.DefaultFileName
 	updateRosterDefault   = false
+	dryRunDefault         = false
+	threadsDefault        = 0
+	depthDefault          = -1
+	flushDefault          = 0
+	sinceDefault          = ""
+	minAgeDefault         = ""
+	maxAgeDefault         = ""
+	gitignoreDefault      = false
+	oneFSDefault          = false
+	compactDefault        = false
+	parallelDefault       = 1
+	pruneDefault          = false
+	parentsDefault        = false
+	hashAlgorithmsDefault = ""
+	jsonOutputDefault     = false
+	quietDefault          = false
+	statsDefault          = false
+	printVersionDefault   = false
+	verboseDefault        = false
+	webhookDefault        = ""
+	failOnDefault         = ""
+	longListDefault       = false
+	nullListDefault       = false
+	exitZeroDefault       = false
 )
 
 const (
@@ -32,6 +68,39 @@ const (
 	exitCodeNew = 1 << 0
 	exitCodeMod = 1 << 1
 	exitCodeDel = 1 << 2
+	exitCodeInc = 1 << 3
+	exitCodeBad = 1 << 4
+	exitCodeMov = 1 << 5
+)
+
+// exitCodeClass maps the name of each kind of file reported, as given to flag
+// -fail-on, to its bit of the program exit code.
+var exitCodeClass = map[string]int{
+	"new": exitCodeNew,
+	"mod": exitCodeMod,
+	"del": exitCodeDel,
+	"inc": exitCodeInc,
+	"bad": exitCodeBad,
+	"mov": exitCodeMov,
+}
+
+// stdioFileName is the roster file name, and directory path, that refers to
+// standard input (and output).
+const stdioFileName = "-"
+
+// Subcommands recognized as the first positional argument.
+const (
+	commandAudit      = "audit"
+	commandCompare    = "compare"
+	commandDiff       = "diff"
+	commandDigest     = "digest"
+	commandIncomplete = "incomplete"
+	commandInit       = "init"
+	commandList       = "list"
+	commandManifest   = "manifest"
+	commandStats      = "stats"
+	commandVerify     = "verify"
+	commandWatch      = "watch"
 )
 
 func main() {
@@ -39,31 +108,623 @@ func main() {
 	var (
 		rosterFileName string
 		updateRoster   bool
+		dryRun         bool
+		threads        int
+		depth          int
+		flush          int
+		since          string
+		minAge         string
+		maxAge         string
+		gitignore      bool
+		oneFS          bool
+		compact        bool
+		parallel       int
+		prune          bool
+		parents        bool
+		hashAlgorithms string
+		jsonOutput     bool
+		quiet          bool
+		stats          bool
+		printVersion   bool
+		verbose        bool
+		webhook        string
+		failOn         string
+		longList       bool
+		nullList       bool
+		exitZero       bool
+		verifyFlags    verifyFlags
 	)
 
 	flag.StringVar(&rosterFileName, "f", rosterFileNameDefault, "roster file name")
 	flag.BoolVar(&updateRoster, "u", updateRosterDefault, "update roster with scan results")
+	flag.BoolVar(&prune, "prune", pruneDefault, "only remove deleted files from roster, without hashing (implies -u)")
+	flag.BoolVar(&dryRun, "n", dryRunDefault, "print roster that -u would write instead of writing it")
+	flag.IntVar(&threads, "t", threadsDefault, "number of worker threads (overrides roster, if nonzero)")
+	flag.BoolVar(&parents, "parents", parentsDefault, "use the roster file of the nearest parent directory containing one, if DIR has none")
+	flag.IntVar(&parallel, "p", parallelDefault, "number of directories scanned concurrently")
+	flag.IntVar(&depth, "d", depthDefault, "maximum recursion depth, 0 for unlimited (overrides roster, if not negative)")
+	flag.StringVar(&since, "since", sinceDefault, "exclude files last modified before this RFC 3339 time (overrides roster, if given)")
+	flag.StringVar(&minAge, "min-age", minAgeDefault, "exclude files last modified more recently than this duration ago, e.g. 24h (overrides roster, if given)")
+	flag.StringVar(&maxAge, "max-age", maxAgeDefault, "exclude files last modified longer than this duration ago, e.g. 720h (overrides roster, if given)")
+	flag.IntVar(&flush, "flush", flushDefault, "commit members to an SQLite (.db) roster every N updates (overrides roster, if nonzero)")
+	flag.BoolVar(&gitignore, "exclude-vcs-ignored", gitignoreDefault, "exclude files ignored by git, using .gitignore of every directory (overrides roster, if given)")
+	flag.BoolVar(&oneFS, "one-file-system", oneFSDefault, "do not traverse directories on other file systems (overrides roster, if given)")
+	flag.BoolVar(&compact, "compact", compactDefault, "write only the attributes of each member that are compared (written to roster, if given)")
+	flag.StringVar(&hashAlgorithms, "hash", hashAlgorithmsDefault, "comma-separated checksum algorithms (overrides roster, if given): "+
+		strings.Join(file.HashAlgorithms(), ", "))
+	flag.BoolVar(&jsonOutput, "j", jsonOutputDefault, "print each file reported as a JSON object, one per line")
+	flag.BoolVar(&quiet, "q", quietDefault, "print nothing except errors, only set exit code")
+	flag.BoolVar(&stats, "stats", statsDefault, "print summary of all files scanned when finished")
+	flag.BoolVar(&printVersion, "V", printVersionDefault, "print version and exit")
+	flag.BoolVar(&verbose, "v", verboseDefault, "print each file excluded and the reason it was excluded")
+	flag.StringVar(&webhook, "webhook", webhookDefault, "URL to POST a JSON summary of all files reported, if any")
+	flag.BoolVar(&longList, "l", longListDefault, "print the permissions, size, and last modification time of each member listed")
+	flag.BoolVar(&nullList, "null", nullListDefault, "terminate each member listed with NUL instead of newline")
+	flag.StringVar(&failOn, "fail-on", failOnDefault, "comma-separated kinds of files reported that set the exit code (default all): new, mod, del, inc, bad, mov")
+	flag.BoolVar(&exitZero, "exit-zero", exitZeroDefault, "exit with code 0 regardless of files reported, unless an error occurred")
+	verifyFlags.define()
 	flag.Parse()
 
-	var new, mod, del uint
-	if err := roster.Take(roster.Taker{
-		NewFile: func(filePath string) { new++; roster.DefaultNewHandler(filePath) },
-		ModFile: func(filePath string) { mod++; roster.DefaultModHandler(filePath) },
-		DelFile: func(filePath string) { del++; roster.DefaultDelHandler(filePath) },
-	}, rosterFileName, updateRoster, flag.Args()...); nil != err {
-		fmt.Printf("error: %s\n", err)
+	if printVersion {
+		printChange()
+		os.Exit(0)
+	}
+
+	mask, err := exitMask(failOn, exitZero)
+	if nil != err {
+		printError(err)
 		os.Exit(exitCodeErr)
 	}
+	// exit with only the selected bits of the exit code, unless it is an error
+	exit := func(code int) {
+		if exitCodeErr != code {
+			code &= mask
+		}
+		os.Exit(code)
+	}
+
+	// roster file "-" is read from standard input and written to standard
+	// output, so all messages are written to standard error instead
+	stdio := rosterFileName == stdioFileName
+	if stdio {
+		roster.Output = os.Stderr
+	}
+
+	take := roster.DefaultTaker
+	if quiet {
+		take = roster.SkipTaker
+		// moves and appends must still be handled to be counted as such
+		take.MovedFile = func(string, string) error { return nil }
+		take.AppendedFile = func(string) error { return nil }
+	} else if jsonOutput {
+		take = roster.JSONTaker(roster.Output)
+	}
+	if verbose && !quiet {
+		take.Skipped = func(path, reason string) {
+			fmt.Fprintf(roster.Output, "~ %s (%s)\n", path, reason)
+		}
+	}
+
+	// options common to all commands that scan using roster files
+	scan := []roster.Option{
+		roster.WithFile(rosterFileName),
+		roster.WithHandlers(take),
+		roster.WithThreads(threads),
+		roster.WithDepth(depth),
+		roster.WithFlush(flush),
+		roster.WithSince(since),
+		roster.WithAge(minAge, maxAge),
+		roster.WithNestedGitignore(gitignore),
+		roster.WithOneFilesystem(oneFS),
+		roster.WithCompact(compact),
+		roster.WithParallel(parallel),
+		roster.WithSearchParents(parents),
+		roster.WithVerify(verifyFlags.apply),
+	}
+	if hashAlgorithms != "" {
+		scan = append(scan, roster.WithHash(strings.Split(hashAlgorithms, ",")...))
+	}
+	if webhook != "" {
+		scan = append(scan, roster.WithWebhook(webhook))
+	}
+
+	// directory path "-" is replaced by the paths read from standard input
+	dirs := func(arg []string) []string {
+		dir, err := readDirs(os.Stdin, arg...)
+		if nil != err {
+			printError(err)
+			os.Exit(exitCodeErr)
+		}
+		return dir
+	}
+
+	if flag.NArg() > 0 {
+		switch subcommand(flag.Arg(0)) {
+		case commandIncomplete:
+			handler := roster.DefaultBadHandler
+			if quiet {
+				handler = roster.SkipHandler
+			}
+			exit(incomplete(handler, rosterFileName, dirs(flag.Args()[1:])...))
+		case commandInit:
+			if err := roster.Init(rosterFileName, dirs(flag.Args()[1:])...); nil != err {
+				printError(err)
+				os.Exit(exitCodeErr)
+			}
+			os.Exit(0)
+		case commandManifest:
+			if err := manifest(rosterFileName, flag.Args()[1:]...); nil != err {
+				printError(err)
+				os.Exit(exitCodeErr)
+			}
+			os.Exit(0)
+		case commandList:
+			if err := list(jsonOutput, longList, nullList, flag.Args()[1:]...); nil != err {
+				printError(err)
+				os.Exit(exitCodeErr)
+			}
+			os.Exit(0)
+		case commandDigest:
+			if err := digest(flag.Args()[1:]...); nil != err {
+				printError(err)
+				os.Exit(exitCodeErr)
+			}
+			os.Exit(0)
+		case commandStats:
+			if err := summarize(jsonOutput, flag.Args()[1:]...); nil != err {
+				printError(err)
+				os.Exit(exitCodeErr)
+			}
+			os.Exit(0)
+		case commandVerify:
+			exit(finish(stats)(verify(take, flag.Args()[1:]...)))
+		case commandCompare:
+			cfg := file.DefaultConfig()
+			verifyFlags.apply(&cfg.Ver)
+			if hashAlgorithms != "" {
+				cfg.Hash = file.Hash(strings.Split(hashAlgorithms, ","))
+			}
+			cfg.Rt.UseNestedGitignore = gitignore
+			cfg.Rt.OneFilesystem = oneFS
+			exit(finish(stats)(compare(take, rosterFileName, cfg, flag.Args()[1:]...)))
+		case commandDiff:
+			ver := file.DefaultVerify()
+			verifyFlags.apply(&ver)
+			exit(finish(stats)(diff(take, ver, flag.Args()[1:]...)))
+		case commandAudit:
+			exit(finish(stats)(audit(append(scan, roster.WithDirs(dirs(flag.Args()[1:])...))...)))
+		case commandWatch:
+			if err := watch(take, rosterFileName, dirs(flag.Args()[1:])...); nil != err {
+				printError(err)
+				os.Exit(exitCodeErr)
+			}
+			os.Exit(0)
+		}
+	}
+
+	opts := append(scan,
+		roster.WithUpdate(updateRoster || dryRun || prune || stdio),
+		roster.WithPrune(prune),
+	)
+	if stdio {
+		for _, arg := range flag.Args() {
+			if arg == stdioFileName {
+				printError(fmt.Errorf("directory path %q cannot be read with roster file %q",
+					stdioFileName, stdioFileName))
+				os.Exit(exitCodeErr)
+			}
+		}
+		opts = append(opts, roster.WithStdio(os.Stdin, os.Stdout))
+	}
+	opts = append(opts, roster.WithDirs(dirs(flag.Args())...))
+	if dryRun {
+		opts = append(opts, roster.WithDryRun(roster.Output))
+	}
+	exit(finish(stats)(roster.TakeWith(opts...)))
+}
+
+// finish returns a function that prints the given error, if not nil, or else
+// prints the given roster.Summary if stats is true, and returns the program
+// exit code.
+func finish(stats bool) func(roster.Summary, error) int {
+	return func(sum roster.Summary, err error) int {
+		if nil != err {
+			printError(err)
+			return exitCodeErr
+		}
+		if stats {
+			printStats(sum)
+		}
+		return exitCode(sum)
+	}
+}
+
+// printChange prints the package name, version, and date of the most recent
+// change in the version.ChangeLog.
+func printChange() {
+	if len(version.ChangeLog) == 0 {
+		return
+	}
+	c := version.ChangeLog[len(version.ChangeLog)-1]
+	fmt.Fprintf(roster.Output, "%s version %s (%s)\n", c.Package, c.Version, c.Date)
+}
+
+// printStats prints a single line summarizing the given roster.Summary.
+func printStats(sum roster.Summary) {
+	fmt.Fprintf(roster.Output,
+		"scanned %d files, %d new, %d modified, %d appended, %d deleted, %d corrupted, %d moved, %s hashed in %s\n",
+		sum.Scanned, sum.New, sum.Mod, sum.App, sum.Del, sum.Bad, sum.Mov,
+		formatBytes(sum.Hashed), sum.Elapsed.Round(time.Millisecond))
+}
+
+// formatBytes returns the given number of bytes as a human-readable string
+// using binary (1024-based) units.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for q := n / unit; q >= unit; q /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// exitMask returns the bits of the program exit code that are set for the kinds
+// of files named in the given comma-separated list (see exitCodeClass), all bits
+// if the list is empty, or no bits if exitZero is true.
+func exitMask(failOn string, exitZero bool) (int, error) {
+	mask := 0
+	if exitZero {
+		return mask, nil
+	}
+	if "" == strings.TrimSpace(failOn) {
+		for _, bit := range exitCodeClass {
+			mask |= bit
+		}
+		return mask, nil
+	}
+	for _, class := range strings.Split(failOn, ",") {
+		bit, ok := exitCodeClass[strings.TrimSpace(class)]
+		if !ok {
+			return 0, fmt.Errorf("invalid -fail-on kind: %q", class)
+		}
+		mask |= bit
+	}
+	return mask, nil
+}
 
+// exitCode returns the program exit code corresponding to the tallies of the
+// given roster.Summary.
+func exitCode(sum roster.Summary) int {
 	exitCode := 0
-	if new > 0 {
+	if sum.New > 0 {
 		exitCode |= exitCodeNew
 	}
-	if mod > 0 {
+	// appended files are modified files
+	if sum.Mod+sum.App > 0 {
 		exitCode |= exitCodeMod
 	}
-	if del > 0 {
+	if sum.Del > 0 {
 		exitCode |= exitCodeDel
 	}
-	os.Exit(exitCode)
+	if sum.Bad > 0 {
+		exitCode |= exitCodeBad
+	}
+	if sum.Mov > 0 {
+		exitCode |= exitCodeMov
+	}
+	return exitCode
+}
+
+// incomplete lists all members of each roster file missing a verified
+// attribute, and returns the program exit code.
+func incomplete(handler roster.Handler, rosterFileName string, path ...string) int {
+	var inc uint
+	if err := roster.Incomplete(func(filePath string) error {
+		inc++
+		if handler != nil {
+			return handler(filePath)
+		}
+		return nil
+	}, rosterFileName, path...); nil != err {
+		printError(err)
+		return exitCodeErr
+	}
+	if inc > 0 {
+		return exitCodeInc
+	}
+	return 0
+}
+
+// verify reports each member of a roster file missing from or not matching the
+// given directory tree, without modifying the roster file.
+func verify(take roster.Taker, path ...string) (roster.Summary, error) {
+	if len(path) != 2 {
+		return roster.Summary{},
+			fmt.Errorf("%s requires a roster file path and a directory path", commandVerify)
+	}
+	return roster.Verify(take, path[0], path[1])
+}
+
+// compare reports the differences between two directory trees without reading
+// or writing any roster file.
+func compare(take roster.Taker, rosterFileName string, cfg file.Config, path ...string) (roster.Summary, error) {
+	if len(path) != 2 {
+		return roster.Summary{},
+			fmt.Errorf("%s requires exactly 2 directory paths", commandCompare)
+	}
+	return roster.Compare(take, rosterFileName, cfg, path[0], path[1])
+}
+
+// diff reports the differences between two roster files without reading the
+// directory trees they index.
+func diff(take roster.Taker, ver file.Verify, path ...string) (roster.Summary, error) {
+	if len(path) != 2 {
+		return roster.Summary{},
+			fmt.Errorf("%s requires exactly 2 roster file paths", commandDiff)
+	}
+	return roster.Diff(take, ver, path[0], path[1])
+}
+
+// manifest prints the checksums recorded with the given algorithm in the roster
+// file of the given directory, formatted for verification with coreutils.
+func manifest(rosterFileName string, arg ...string) error {
+	if len(arg) != 2 {
+		return fmt.Errorf("%s requires a hash algorithm and a directory path", commandManifest)
+	}
+	return roster.Manifest(roster.Output, rosterFileName, arg[0], arg[1])
+}
+
+// list prints the path of each member of the given roster file, sorted by path,
+// without reading the directory tree it indexes. Each path is preceded by the
+// permissions, size, and last modification time of the member if long is true,
+// or printed along with its Status as a JSON object if asJSON is true. Each is
+// terminated by NUL instead of newline if null is true.
+func list(asJSON, long, null bool, arg ...string) error {
+	if len(arg) != 1 {
+		return fmt.Errorf("%s requires exactly 1 roster file path", commandList)
+	}
+	ros, err := parseRoster(arg[0])
+	if nil != err {
+		return err
+	}
+	defer ros.Close()
+	end := "\n"
+	if null {
+		end = "\x00"
+	}
+	w := bufio.NewWriter(roster.Output)
+	for _, filePath := range ros.Members() {
+		stat, _ := ros.Status(filePath)
+		line := filePath
+		switch {
+		case asJSON:
+			data, err := json.Marshal(struct {
+				Path   string      `json:"path"`
+				Status file.Status `json:"status"`
+			}{filePath, stat})
+			if nil != err {
+				return err
+			}
+			line = string(data)
+		case long:
+			line = fmt.Sprintf("%s %12d %s %s", stat.Perms, stat.Fsize, stat.Mtime, filePath)
+		}
+		if _, err := w.WriteString(line + end); nil != err {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// parseRoster parses the given roster file, which must exist.
+func parseRoster(path string) (*file.Roster, error) {
+	// a missing roster file would otherwise be parsed as an empty roster
+	if _, err := os.Stat(path); nil != err {
+		return nil, err
+	}
+	return file.Parse(path)
+}
+
+// digest prints the digest of the members of each of the given roster files
+// (see file.Roster.Digest), followed by two spaces and the roster file path,
+// without reading the directory trees they index.
+func digest(arg ...string) error {
+	if len(arg) == 0 {
+		return fmt.Errorf("%s requires at least 1 roster file path", commandDigest)
+	}
+	for _, path := range arg {
+		ros, err := parseRoster(path)
+		if nil != err {
+			return err
+		}
+		sum := ros.Digest()
+		ros.Close()
+		fmt.Fprintf(roster.Output, "%s  %s\n", sum, path)
+	}
+	return nil
+}
+
+// summarize prints the aggregate attributes of all members of the given roster
+// file, as a single JSON object if asJSON is true, without reading the directory
+// tree it indexes.
+func summarize(asJSON bool, arg ...string) error {
+	if len(arg) != 1 {
+		return fmt.Errorf("%s requires exactly 1 roster file path", commandStats)
+	}
+	ros, err := parseRoster(arg[0])
+	if nil != err {
+		return err
+	}
+	defer ros.Close()
+	st := ros.Stats()
+	if asJSON {
+		return json.NewEncoder(roster.Output).Encode(st)
+	}
+	mtime := func(t time.Time) string {
+		if t.IsZero() {
+			return file.StatusNoMtime
+		}
+		return file.FormatMtime(t)
+	}
+	fmt.Fprintf(roster.Output, "members: %d (%d directories)\n", st.Members, st.Dirs)
+	fmt.Fprintf(roster.Output, "size:    %s (%d bytes)\n", formatBytes(st.Size), st.Size)
+	fmt.Fprintf(roster.Output, "oldest:  %s\n", mtime(st.Oldest))
+	fmt.Fprintf(roster.Output, "newest:  %s\n", mtime(st.Newest))
+	// extensions with the most files first
+	fmt.Fprintln(roster.Output, "files per extension:")
+	ext := make([]string, 0, len(st.Ext))
+	for e := range st.Ext {
+		ext = append(ext, e)
+	}
+	sort.Slice(ext, func(i, j int) bool {
+		if st.Ext[ext[i]] != st.Ext[ext[j]] {
+			return st.Ext[ext[i]] > st.Ext[ext[j]]
+		}
+		return ext[i] < ext[j]
+	})
+	for _, e := range ext {
+		name := e
+		if "" == name {
+			name = "(none)"
+		}
+		fmt.Fprintf(roster.Output, "  %-10s %d\n", name, st.Ext[e])
+	}
+	return nil
+}
+
+// audit reports all files that no longer match their recorded status without
+// updating any roster file.
+func audit(opts ...roster.Option) (roster.Summary, error) {
+	return roster.AuditWith(opts...)
+}
+
+// watch keeps each roster file current until interrupted.
+func watch(take roster.Taker, rosterFileName string, path ...string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return roster.Watch(ctx, take, rosterFileName, path...)
+}
+
+// subcommand returns the given first positional argument if it may name a
+// subcommand, or an empty string if a file or directory exists at that path, so
+// that a directory with the same name as a subcommand is still scanned.
+func subcommand(arg string) string {
+	if _, err := os.Lstat(arg); nil == err {
+		return ""
+	}
+	return arg
+}
+
+// readDirs returns the given directory paths with each path "-" replaced by the
+// paths read from the given io.Reader, one per line, ignoring blank lines. The
+// io.Reader is only read for the first path "-", and any others are removed.
+func readDirs(r io.Reader, arg ...string) ([]string, error) {
+	dir := []string{}
+	read := false
+	for _, a := range arg {
+		if a != stdioFileName {
+			dir = append(dir, a)
+			continue
+		}
+		if read {
+			continue
+		}
+		read = true
+		scan := bufio.NewScanner(r)
+		for scan.Scan() {
+			if line := strings.TrimRight(scan.Text(), "\r"); line != "" {
+				dir = append(dir, line)
+			}
+		}
+		if err := scan.Err(); nil != err {
+			return nil, err
+		}
+	}
+	return dir, nil
+}
+
+// printError prints the given error, or each error individually if it is of
+// type walk.Errors.
+func printError(err error) {
+	if errs, ok := err.(walk.Errors); ok {
+		for _, e := range errs {
+			fmt.Fprintf(roster.Output, "error: %s\n", e)
+		}
+		return
+	}
+	fmt.Fprintf(roster.Output, "error: %s\n", err)
+}
+
+// toggle is a boolean flag that records whether or not it was given, so that it
+// only overrides a setting when given.
+type toggle struct {
+	set, val bool
+}
+
+// String returns the value of the receiver toggle t.
+func (t *toggle) String() string {
+	return strconv.FormatBool(nil != t && t.val)
+}
+
+// Set parses the given string as the value of the receiver toggle t.
+func (t *toggle) Set(s string) error {
+	val, err := strconv.ParseBool(s)
+	if nil != err {
+		return err
+	}
+	t.set, t.val = true, val
+	return nil
+}
+
+// IsBoolFlag allows the receiver toggle t to be given without a value.
+func (t *toggle) IsBoolFlag() bool { return true }
+
+// verifyFlags contains the flags overriding each file.Verify setting.
+type verifyFlags struct {
+	all, size, perms, mtime, check, owner, link toggle
+}
+
+// define defines the flags of the receiver verifyFlags v.
+func (v *verifyFlags) define() {
+	flag.Var(&v.all, "all", "compare all attributes (overrides roster, if given)")
+	flag.Var(&v.size, "size", "compare file size (overrides roster, if given)")
+	flag.Var(&v.perms, "perms", "compare permissions (overrides roster, if given)")
+	flag.Var(&v.mtime, "mtime", "compare last modification time (overrides roster, if given)")
+	flag.Var(&v.check, "check", "compare checksum (overrides roster, if given)")
+	flag.Var(&v.owner, "owner", "compare owner (overrides roster, if given)")
+	flag.Var(&v.link, "link", "compare symbolic link target (overrides roster, if given)")
+}
+
+// apply overrides each setting of the given file.Verify whose flag was given,
+// with flag -all applied before all others.
+func (v *verifyFlags) apply(ver *file.Verify) {
+	if v.all.set {
+		*ver = file.Verify{
+			Fsize: v.all.val,
+			Perms: v.all.val,
+			Mtime: v.all.val,
+			Check: v.all.val,
+			Owner: v.all.val,
+			Link:  v.all.val,
+		}
+	}
+	for _, o := range []struct {
+		flag *toggle
+		attr *bool
+	}{
+		{&v.size, &ver.Fsize},
+		{&v.perms, &ver.Perms},
+		{&v.mtime, &ver.Mtime},
+		{&v.check, &ver.Check},
+		{&v.owner, &ver.Owner},
+		{&v.link, &ver.Link},
+	} {
+		if o.flag.set {
+			*o.attr = o.flag.val
+		}
+	}
 }
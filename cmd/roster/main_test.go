@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSubcommandDirectory(t *testing.T) {
+	wd, err := os.Getwd()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); nil != err {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	if err := os.Mkdir(commandInit, 0755); nil != err {
+		t.Fatal(err)
+	}
+	// a directory with the same name as a subcommand is scanned
+	if got := subcommand(commandInit); "" != got {
+		t.Errorf("subcommand(%q) = %q, want directory", commandInit, got)
+	}
+	if got := subcommand(commandList); commandList != got {
+		t.Errorf("subcommand(%q) = %q, want %q", commandList, got, commandList)
+	}
+}
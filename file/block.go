@@ -0,0 +1,124 @@
+package file
+
+import (
+	"encoding/hex"
+	"hash"
+)
+
+// Blocks stores the checksum of each consecutive block of a file's content, so
+// that a file modified only by appending content to it can be identified (see
+// Runtime.HashBlock and Status.Appended).
+type Blocks struct {
+	Size int64    `yaml:"size" json:"size"` // number of bytes per block
+	Hash string   `yaml:"hash" json:"hash"` // algorithm used to hash each block
+	Sums []string `yaml:"sums" json:"sums"` // hex-encoded digest of each block
+	app  bool     // content was only appended to that of the prior Status
+}
+
+// blockWriter hashes each consecutive block of all bytes written to it. If the
+// prior Blocks of the same file are given, it also determines whether or not
+// the prior content of the file is unchanged, by comparing the checksums of
+// each prior block with those of the same bytes as written.
+type blockWriter struct {
+	size  int64
+	algo  string
+	hash  hash.Hash
+	sums  []string
+	off   int64   // number of bytes written
+	prior *Blocks // checksums of the prior content, if any
+	end   int64   // size of the prior content
+	mark  string  // checksum of the final block of the prior content
+}
+
+// newBlockWriter returns a new blockWriter hashing blocks of the given size with
+// the given algorithm. If the given prior Status of the same file has Blocks of
+// the same size and algorithm, and its size is less than the given current
+// size of the file, its content is compared with that written.
+func newBlockWriter(size int64, algo string, prior Status, curr int64) *blockWriter {
+	fn, ok := hashFunc[algo]
+	if !ok {
+		return nil
+	}
+	b := &blockWriter{size: size, algo: algo, hash: fn(), sums: []string{}}
+	if p := prior.Block; nil != p && p.Size == size && p.Hash == algo &&
+		prior.Fsize >= 0 && prior.Fsize < curr {
+		b.prior, b.end = p, prior.Fsize
+	}
+	return b
+}
+
+// Write hashes the given bytes, completing each block as it is filled.
+func (b *blockWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		// the bytes remaining in the current block, or in the prior content if
+		// it ends within the current block
+		rem := b.size - b.off%b.size
+		if nil != b.prior && b.off < b.end && b.end-b.off < rem {
+			rem = b.end - b.off
+		}
+		w := p
+		if int64(len(w)) > rem {
+			w = w[:rem]
+		}
+		b.hash.Write(w)
+		b.off += int64(len(w))
+		p = p[len(w):]
+		if nil != b.prior && b.off == b.end && b.end%b.size != 0 {
+			// Sum does not change the underlying hash state
+			b.mark = hex.EncodeToString(b.hash.Sum(nil))
+		}
+		if b.off%b.size == 0 {
+			b.sums = append(b.sums, hex.EncodeToString(b.hash.Sum(nil)))
+			b.hash.Reset()
+		}
+	}
+	return n, nil
+}
+
+// reset discards all bytes written.
+func (b *blockWriter) reset() {
+	b.hash.Reset()
+	b.sums, b.off, b.mark = []string{}, 0, ""
+}
+
+// blocks returns the Blocks of all bytes written, including the final partial
+// block, if any.
+func (b *blockWriter) blocks() *Blocks {
+	sums := b.sums
+	if b.off%b.size != 0 {
+		sums = append(sums, hex.EncodeToString(b.hash.Sum(nil)))
+	}
+	return &Blocks{Size: b.size, Hash: b.algo, Sums: sums, app: b.appended()}
+}
+
+// appended returns whether or not the bytes written begin with the prior content
+// of the file, as identified by the checksum of each of its blocks.
+func (b *blockWriter) appended() bool {
+	if nil == b.prior || b.off <= b.end {
+		return false
+	}
+	full := int(b.end / b.size)
+	num := full
+	if b.end%b.size != 0 {
+		num++
+	}
+	if len(b.prior.Sums) != num || len(b.sums) < full {
+		return false
+	}
+	for i := 0; i < full; i++ {
+		if b.sums[i] != b.prior.Sums[i] {
+			return false
+		}
+	}
+	return num == full || b.mark == b.prior.Sums[full]
+}
+
+// Appended returns whether or not the receiver Status s, as returned by
+// Roster.Changed, identifies a file modified only by appending content to the
+// content recorded in its prior Status, which is only possible if both have
+// Blocks (see Runtime.HashBlock). Other attributes compared by Roster.Changed,
+// besides size, last modification time, and checksums, are unchanged.
+func (s Status) Appended() bool {
+	return nil != s.Block && s.Block.app
+}
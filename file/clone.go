@@ -0,0 +1,73 @@
+package file
+
+// Clone returns a copy of the receiver Roster ros, with a deep copy of its
+// configuration, all of its members, the list of absent members, and the prior
+// Status of each member, so that the copy may be read and modified without
+// affecting ros, even while ros is updated concurrently (e.g., by a watch). The
+// Status of each member is copied either before or after any concurrent update
+// of that member.
+// The copy holds all members in memory, even if those of ros are stored in a
+// database, and writing the copy replaces the roster file the same as writing
+// ros.
+func (ros *Roster) Clone() *Roster {
+	c := New(true, ros.path)
+	c.Cfg = ros.Cfg.clone()
+	c.sql, c.ro, c.self, c.root, c.base = ros.sql, ros.ro, ros.self, ros.root, ros.base
+
+	ros.gitlk.RLock()
+	c.git = append(IgnoreRegexp{}, ros.git...)
+	for dir := range ros.gitDir {
+		c.gitDir[dir] = true
+	}
+	c.gitExcl = ros.gitExcl
+	ros.gitlk.RUnlock()
+
+	defer ros.lock()()
+	c.mem = ros.mem.clone()
+	if nil != ros.db {
+		for _, filePath := range ros.db.Members() {
+			stat, _ := ros.db.Status(filePath)
+			c.mem.Update(filePath, stat)
+		}
+		for filePath, stat := range ros.db.priors() {
+			c.mem.setPrior(filePath, stat)
+		}
+		abs := map[string]bool{}
+		for _, filePath := range ros.db.absentees() {
+			abs[filePath] = true
+		}
+		c.mem.resetAbsent(func(filePath string, _ Status) bool { return abs[filePath] })
+	}
+	return c
+}
+
+// clone returns a deep copy of the receiver Config cfg.
+func (cfg Config) clone() Config {
+	c := cfg
+	c.Hash = append(Hash{}, cfg.Hash...)
+	c.Ign = append(Ignore{}, cfg.Ign...)
+	c.Inc = append(Ignore{}, cfg.Inc...)
+	// compiled patterns are safe for concurrent use, and are never modified
+	c.ire = append(IgnoreRegexp{}, cfg.ire...)
+	c.icr = append(IgnoreRegexp{}, cfg.icr...)
+	return c
+}
+
+// clone returns a deep copy of the receiver Status s.
+func (s Status) clone() Status {
+	c := s
+	c.Check = Checksums{}
+	for algo, sum := range s.Check {
+		c.Check[algo] = sum
+	}
+	if nil != s.Mode {
+		mode := *s.Mode
+		c.Mode = &mode
+	}
+	if nil != s.Block {
+		blk := *s.Block
+		blk.Sums = append([]string{}, s.Block.Sums...)
+		c.Block = &blk
+	}
+	return c
+}
@@ -0,0 +1,108 @@
+package file
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configComment documents each roster configuration setting, keyed by the path
+// of the setting's YAML key, where each key is separated by ".".
+var configComment = map[string]string{
+	"config":                         "roster configuration; all settings below may be edited",
+	"config.runtime":                 "settings controlling how the directory tree is scanned",
+	"config.runtime.threads":         "number of files processed concurrently (0 = number of CPUs)",
+	"config.runtime.maxdepth":        "maximum directory depth, where the root directory has depth 1 (0 = unlimited)",
+	"config.runtime.hashhead":        "hash only this many leading bytes of each file (0 = entire file)",
+	"config.runtime.hashchunk":       "hash large files concurrently in chunks of this many bytes (0 = single chunk)",
+	"config.runtime.queue":           "number of files per thread discovered ahead of processing",
+	"config.runtime.hashblock":       "record checksums of blocks of this many bytes to identify appended files (0 = never)",
+	"config.runtime.mmap":            "map files of at least this many bytes into memory to hash them (0 = never)",
+	"config.runtime.gitignore":       "also exclude files matching patterns in .gitignore",
+	"config.runtime.gitignorenested": "also exclude files matching patterns in .gitignore of every directory and git excludes",
+	"config.runtime.minfilesize":     "exclude files smaller than this many bytes (0 = no limit)",
+	"config.runtime.maxfilesize":     "exclude files larger than this many bytes (0 = no limit)",
+	"config.runtime.since":           "exclude files last modified before this time (RFC 3339, empty = no limit)",
+	"config.runtime.minage":          "exclude files last modified more recently than this duration ago (e.g., 24h; empty = no limit)",
+	"config.runtime.maxage":          "exclude files last modified longer than this duration ago (e.g., 720h; empty = no limit)",
+	"config.runtime.basepath":        "relative path prepended to the path of each member as recorded",
+	"config.runtime.backup":          "rename the previous roster file with extension .bak on update",
+	"config.runtime.tempdir":         "directory in which the roster file is written before replacing it (empty = roster's directory)",
+	"config.runtime.compact":         "write only the attributes of each member that are compared (see verify)",
+	"config.runtime.timezone":        "time zone of modification times written to the roster file (empty = UTC, Local, or IANA name)",
+	"config.runtime.indexdirs":       "also index directories, including empty directories",
+	"config.runtime.indexunreadable": "index files whose content cannot be read without checksums, rather than excluding them",
+	"config.runtime.onefilesystem":   "do not traverse directories on other file systems (e.g., mount points)",
+	"config.runtime.canonicalize":    "exclude symbolic links resolving to another file in the tree, which is indexed on its own",
+	"config.runtime.retry":           "hash files again this many times after a transient I/O error (0 = never)",
+	"config.runtime.retrydelay":      "delay before the first retry, doubled before each subsequent retry (e.g., 250ms; empty = 100ms)",
+	"config.runtime.flush":           "commit members to an SQLite roster every this many updates (0 = once finished)",
+	"config.verify":                  "attributes compared to identify changed files",
+	"config.verify.filesize":         "compare file size",
+	"config.verify.permissions":      "compare permissions",
+	"config.verify.lastmodtime":      "compare last modification time",
+	"config.verify.checksum":         "compare checksums of file content",
+	"config.verify.owner":            "compare owner user and group IDs",
+	"config.verify.symlink":          "index symbolic links, comparing the path each refers to",
+	"config.hash":                    "checksum algorithm(s): " + strings.Join(HashAlgorithms(), ", "),
+	"config.ignore":                  "exclude files matching any of these patterns",
+	"config.include":                 "if not empty, only index files matching any of these patterns",
+	"config.syntax": "default syntax of ignore and include patterns (" +
+		SyntaxRegexp + " or " + SyntaxGlob + "); a pattern may override it with prefix \"" +
+		SyntaxRegexp + SyntaxSep + "\" or \"" + SyntaxGlob + SyntaxSep + "\", or be negated with prefix \"" +
+		SyntaxNegate + "\"",
+	"config.ignorefile":     "file of additional ignore patterns, one per line, preceding the ignore patterns (relative to the roster's directory)",
+	"config.ignorecase":     "match ignore and include patterns regardless of case",
+	"config.ignoreabsolute": "also match ignore patterns against absolute file paths (include patterns always match relative paths)",
+	"config.filemode":       "permissions of the roster file (octal)",
+	"members":               "index of all files; do not edit",
+}
+
+// MarshalDocumented returns the receiver Roster ros's configuration and member
+// data formatted the same as Marshal, except that if the roster file is in YAML
+// format, each configuration setting is preceded by a comment documenting it.
+func (ros *Roster) MarshalDocumented() ([]byte, error) {
+	if FormatYAML != FormatOf(ros.path) {
+		return ros.Marshal()
+	}
+	var doc yaml.Node
+	if err := doc.Encode(ros.encoded()); nil != err {
+		return nil, err
+	}
+	comment(&doc, "")
+	return yaml.Marshal(&doc)
+}
+
+// comment sets the head comment of each key in the given YAML mapping node, and
+// all mapping nodes nested within it, whose path has an entry in configComment.
+// The given prefix is the path of the given node.
+func comment(node *yaml.Node, prefix string) {
+	if yaml.MappingNode != node.Kind {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, val := node.Content[i], node.Content[i+1]
+		path := key.Value
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		if c, ok := configComment[path]; ok {
+			key.HeadComment = c
+		}
+		comment(val, path)
+	}
+}
+
+// WriteDocumented writes the receiver Roster ros to disk the same as Write, but
+// formatted with MarshalDocumented.
+func (ros *Roster) WriteDocumented() error {
+	if FormatSQLite == FormatOf(ros.path) {
+		// comments cannot be stored in a database
+		return ros.Write()
+	}
+	data, err := ros.MarshalDocumented()
+	if nil != err {
+		return err
+	}
+	return ros.write(data)
+}
@@ -0,0 +1,107 @@
+package file
+
+import (
+	"encoding/json"
+
+	"gopkg.in/yaml.v3"
+)
+
+// compactRoster is the encoding of a roster file whose members are written
+// without the attributes that are not compared (see Runtime.Compact).
+type compactRoster struct {
+	Cfg Config                   `yaml:"config" json:"config"`
+	Mem map[string]compactStatus `yaml:"members" json:"members"`
+}
+
+// compactStatus is the encoding of a Status in a compact roster file, which
+// omits each attribute that is not recorded.
+type compactStatus struct {
+	Fsize *int64    `yaml:"size,omitempty" json:"size,omitempty"`
+	Perms string    `yaml:"perm,omitempty" json:"perm,omitempty"`
+	Mtime string    `yaml:"last,omitempty" json:"last,omitempty"`
+	Check Checksums `yaml:"hash,omitempty" json:"hash,omitempty"`
+	Owner string    `yaml:"own,omitempty" json:"own,omitempty"`
+	Link  string    `yaml:"link,omitempty" json:"link,omitempty"`
+	Mode  *FileMode `yaml:"mode,omitempty" json:"mode,omitempty"`
+	Block *Blocks   `yaml:"blocks,omitempty" json:"blocks,omitempty"`
+}
+
+// compacted returns the encoding of a compact roster file with the given
+// configuration and members.
+func compacted(cfg Config, mem Member) *compactRoster {
+	com := &compactRoster{Cfg: cfg, Mem: make(map[string]compactStatus, len(mem))}
+	for filePath, stat := range mem {
+		com.Mem[filePath] = stat.compact(cfg.Ver)
+	}
+	return com
+}
+
+// compact returns the encoding of the receiver Status s in a compact roster
+// file, with only the attributes compared per the given Verify settings. The
+// permissions of a directory are always kept, since they identify it as such
+// (see IsDir).
+func (s Status) compact(ver Verify) compactStatus {
+	var c compactStatus
+	if ver.Fsize && StatusNoFsize != s.Fsize {
+		size := s.Fsize
+		c.Fsize = &size
+	}
+	if (ver.Perms || s.IsDir()) && StatusNoPerms != s.Perms {
+		c.Perms = s.Perms
+	}
+	if ver.Perms {
+		c.Mode = s.Mode
+	}
+	if ver.Mtime && StatusNoMtime != s.Mtime {
+		c.Mtime = s.Mtime
+	}
+	if ver.Check {
+		c.Check, c.Block = s.Check, s.Block
+	}
+	if ver.Owner && StatusNoOwner != s.Owner {
+		c.Owner = s.Owner
+	}
+	if ver.Link {
+		c.Link = s.Link
+	}
+	return c
+}
+
+// Recorded returns a Verify struct with each attribute set true for verification
+// only if it is recorded in the receiver Status s, i.e., not equal to that of
+// NoStatus, which may not be the case if it was read from a compact roster file.
+func (s Status) Recorded() Verify {
+	return Verify{
+		Fsize: StatusNoFsize != s.Fsize,
+		Perms: StatusNoPerms != s.Perms && "" != s.Perms,
+		Mtime: StatusNoMtime != s.Mtime && "" != s.Mtime,
+		Check: len(s.Check) > 0,
+		Owner: StatusNoOwner != s.Owner && "" != s.Owner,
+		Link:  true,
+	}
+}
+
+// status has the same fields as Status, but none of its methods, so that it is
+// decoded without calling UnmarshalYAML or UnmarshalJSON recursively.
+type status Status
+
+// UnmarshalYAML decodes the receiver Status s, with each attribute missing from
+// the given node (e.g., in a compact roster file) equal to that of NoStatus.
+func (s *Status) UnmarshalYAML(value *yaml.Node) error {
+	st := status(NoStatus())
+	if err := value.Decode(&st); nil != err {
+		return err
+	}
+	*s = Status(st)
+	return nil
+}
+
+// UnmarshalJSON decodes the receiver Status s the same as UnmarshalYAML.
+func (s *Status) UnmarshalJSON(data []byte) error {
+	st := status(NoStatus())
+	if err := json.Unmarshal(data, &st); nil != err {
+		return err
+	}
+	*s = Status(st)
+	return nil
+}
@@ -0,0 +1,84 @@
+package file
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+)
+
+// Digest returns the hex-encoded SHA-256 digest of a canonical serialization of
+// the receiver Roster ros's Verify settings and checksum algorithms, followed by
+// the path of each member, in sorted order, along with each of its attributes
+// compared per those Verify settings (see Status.Equals).
+// Thus, two rosters with equal digests have the same members with the same
+// attributes, and Diff would identify no differences between them using their
+// Verify settings, so that their digests may be compared to cheaply determine
+// whether or not a Diff or Merge is necessary. Rosters with different digests
+// may still have no differences, e.g., if their members were recorded with
+// different checksum algorithms, or only one of them recorded the numeric
+// permission bits of its members (see Status.Mode).
+func (ros *Roster) Digest() string {
+	defer ros.lock()()
+
+	h := sha256.New()
+	// each field is terminated with a NUL byte, which is never part of a
+	// file path, and each member is preceded by an empty field
+	field := func(s string) {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+
+	ver := ros.Cfg.Ver
+	for _, b := range []bool{ver.Fsize, ver.Perms, ver.Mtime, ver.Check, ver.Owner, ver.Link} {
+		field(strconv.FormatBool(b))
+	}
+	hash := append([]string{}, ros.Cfg.Hash...)
+	sort.Strings(hash)
+	for _, algo := range hash {
+		field(algo)
+	}
+
+	mem := ros.store()
+	for _, filePath := range mem.Members() {
+		stat, _ := mem.Status(filePath)
+		field("")
+		field(filePath)
+		if ver.Perms {
+			if nil != stat.Mode {
+				field(strconv.FormatUint(uint64(*stat.Mode), 8))
+			} else {
+				field(stat.Perms)
+			}
+		}
+		if ver.Owner {
+			field(stat.Owner)
+		}
+		// only the permissions and owner of directories are compared
+		if stat.IsDir() {
+			field("d")
+			continue
+		}
+		if ver.Fsize {
+			field(strconv.FormatInt(stat.Fsize, 10))
+		}
+		if ver.Mtime {
+			field(stat.Mtime)
+		}
+		if ver.Check {
+			sums := make([]string, 0, len(stat.Check))
+			for _, sum := range stat.Check {
+				sums = append(sums, sum)
+			}
+			sort.Strings(sums)
+			field(strconv.Itoa(len(sums)))
+			for _, sum := range sums {
+				field(sum)
+			}
+		}
+		if ver.Link {
+			field(stat.Link)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
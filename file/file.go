@@ -1,22 +1,32 @@
 // Package file provides the capability to parse from and write to disk a roster
 // configuration and index file.
-// The roster file is currently implemented in YAML format to minimize file size
-// and also permit user annotation with comments.
+// The roster file is implemented in YAML format by default to minimize file size
+// and also permit user annotation with comments, or in JSON format if its file
+// name has extension ".json". For machine-only use, the roster file may also be
+// implemented in the much faster gob format if its file name has extension
+// ".gob". Any format may be compressed with gzip.
 package file
 
 import (
+	"bufio"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 	"unicode/utf8"
+	"unsafe"
 
-	"github.com/cespare/xxhash"
 	"gopkg.in/yaml.v3"
 )
 
@@ -24,6 +34,12 @@ type (
 	DirectoryNotFoundError string
 	InvalidPathError       string
 	NotRegularFileError    string
+	UnsupportedHashError   string
+	UnsupportedFormatError string
+	MergeConflictError     string
+	InvalidTimeError       string
+	InvalidDurationError   string
+	InvalidTimeZoneError   string
 )
 
 // Error returns the error message for DirectoryNotFoundError.
@@ -41,18 +57,113 @@ func (e NotRegularFileError) Error() string {
 	return "not a regular file: " + string(e)
 }
 
-// Permissions defines the default permissions of roster files written to disk.
+// Error returns the error message for UnsupportedHashError.
+func (e UnsupportedHashError) Error() string {
+	return "unsupported hash algorithm: " + string(e)
+}
+
+// Error returns the error message for UnsupportedFormatError.
+func (e UnsupportedFormatError) Error() string {
+	return "unsupported roster file format: " + string(e)
+}
+
+// Error returns the error message for MergeConflictError.
+func (e MergeConflictError) Error() string {
+	return "conflicting member status: " + string(e)
+}
+
+// Error returns the error message for InvalidTimeError.
+func (e InvalidTimeError) Error() string {
+	return "invalid time (RFC 3339 required): " + string(e)
+}
+
+// Error returns the error message for InvalidDurationError.
+func (e InvalidDurationError) Error() string {
+	return "invalid duration: " + string(e)
+}
+
+// Error returns the error message for InvalidTimeZoneError.
+func (e InvalidTimeZoneError) Error() string {
+	return "invalid time zone: " + string(e)
+}
+
+// Permissions defines the default permissions of roster files written to disk,
+// used when a roster's configuration does not specify any (see Config.Perm).
 var Permissions os.FileMode = 0600
 
+// FileMode represents the permissions of a file, such as the roster file written
+// to disk (see Config.Perm) or a member (see Status.Mode). It is encoded as a
+// string of octal digits (e.g., "0640") in the roster file.
+type FileMode os.FileMode
+
+// String returns the receiver FileMode m as a string of octal digits.
+func (m FileMode) String() string {
+	return fmt.Sprintf("%#04o", uint32(m))
+}
+
+// parseFileMode parses the given string of octal digits as a FileMode.
+func parseFileMode(s string) (FileMode, error) {
+	u, err := strconv.ParseUint(s, 8, 32)
+	if nil != err {
+		return 0, fmt.Errorf("invalid file mode: %s", s)
+	}
+	return FileMode(os.FileMode(u) & os.ModePerm), nil
+}
+
+// UnmarshalYAML decodes a string of octal digits into the receiver FileMode m.
+func (m *FileMode) UnmarshalYAML(value *yaml.Node) error {
+	mode, err := parseFileMode(value.Value)
+	if nil != err {
+		return err
+	}
+	*m = mode
+	return nil
+}
+
+// MarshalYAML encodes the receiver FileMode m as a string of octal digits.
+func (m FileMode) MarshalYAML() (interface{}, error) {
+	return m.String(), nil
+}
+
+// UnmarshalJSON decodes a string of octal digits into the receiver FileMode m.
+func (m *FileMode) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); nil != err {
+		return err
+	}
+	mode, err := parseFileMode(s)
+	if nil != err {
+		return err
+	}
+	*m = mode
+	return nil
+}
+
+// MarshalJSON encodes the receiver FileMode m as a string of octal digits.
+func (m FileMode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
 // Roster represents a roster file, containing the index of all member files in
 // a directory tree.
 type Roster struct {
 	path  string
-	memlk sync.Mutex
-	abslk sync.Mutex
-	Cfg   Config `yaml:"config"`  // roster configuration
-	Mem   Member `yaml:"members"` // index of all files
-	abs   Absent
+	memlk sync.Mutex // guards db and pend, only used if sql (see lock)
+	Cfg   Config     `yaml:"config" json:"config"`   // roster configuration
+	Mem   Member     `yaml:"members" json:"members"` // index of all files, as encoded
+	mem   *shards    // members held in memory, with prior Status of changed files (see Prior)
+	sql   bool       // roster file has extension FormatSQLiteExt
+	ro    bool       // roster will not be written (see ReadOnly)
+	self  string     // roster file path relative to the walk root (see SetRoot)
+	root  string     // absolute path of the walk root, with slash separators (see SetRoot)
+	db    *sqlStore  // if not nil, stores members in place of mem (see Store)
+	pend  int        // updates not yet flushed to the database (see Runtime.Flush)
+	base  string     // prefix of each member path as recorded (see Runtime.BasePath)
+
+	gitlk   sync.RWMutex
+	git     IgnoreRegexp    // git ignore patterns, preceding Cfg.ire (see Gitignore)
+	gitDir  map[string]bool // directories whose .gitignore patterns were added
+	gitExcl bool            // global and repository exclude patterns were added
 }
 
 // IgnoreDefault defines the default Ignore patterns used when creating a new
@@ -61,51 +172,527 @@ var IgnoreDefault = Ignore{"\\.git", "\\.svn"}
 
 // Config contains settings for constructing and verifying the roster index.
 type Config struct {
-	Rt  Runtime `yaml:"runtime"` // various runtime settings
-	Ver Verify  `yaml:"verify"`  // attributes used to identify changed files
-	Ign Ignore  `yaml:"ignore"`  // file patterns to exclude from roster index
-	ire IgnoreRegexp
+	Rt   Runtime `yaml:"runtime" json:"runtime"` // various runtime settings
+	Ver  Verify  `yaml:"verify" json:"verify"`   // attributes used to identify changed files
+	Hash Hash    `yaml:"hash" json:"hash"`       // checksum algorithms (see HashAlgorithms)
+	Ign  Ignore  `yaml:"ignore" json:"ignore"`   // file patterns to exclude from roster index
+	Inc  Ignore  `yaml:"include" json:"include"` // if not empty, only index matching files
+	Syn  string  `yaml:"syntax" json:"syntax"`   // default syntax of Ign and Inc patterns
+	ire  IgnoreRegexp
+	icr  IgnoreRegexp
+
+	IgnoreFile            string   `yaml:"ignorefile" json:"ignorefile"`         // if not empty, file of patterns preceding Ign
+	IgnoreCaseInsensitive bool     `yaml:"ignorecase" json:"ignorecase"`         // match Ign and Inc regardless of case
+	IgnoreAbsolute        bool     `yaml:"ignoreabsolute" json:"ignoreabsolute"` // also match Ign against absolute paths
+	Perm                  FileMode `yaml:"filemode" json:"filemode"`             // permissions of the roster file
 }
 
 // Constants representing special-purpose values for Runtime fields.
 const (
-	RuntimeThreadsNoLimit = 0 // number of threads limited to number of CPUs
-	RuntimeDepthNoLimit   = 0 // unlimited recursion
+	RuntimeThreadsNoLimit   = 0  // number of threads limited to number of CPUs
+	RuntimeDepthNoLimit     = 0  // unlimited recursion
+	RuntimeHashHeadNoLimit  = 0  // checksum computed over entire file content
+	RuntimeHashChunkNoLimit = 0  // checksum computed as a single chunk
+	RuntimeQueueDefault     = 4  // files queued per thread awaiting processing
+	RuntimeFileSizeNoLimit  = 0  // files of any size are indexed
+	RuntimeFlushNever       = 0  // members committed only once the walk completes
+	RuntimeSinceNoLimit     = "" // files of any modification time are indexed
+	RuntimeAgeNoLimit       = "" // files of any age are indexed
+	RuntimeMmapNever        = 0  // files are always read to compute checksums
+	RuntimeHashBlockNever   = 0  // no checksums recorded per block
+	RuntimeTimeZoneUTC      = "" // last modification times written in UTC
+	RuntimeRetryNever       = 0  // files that cannot be read are never hashed again
+	RuntimeRetryDelayNone   = "" // first retry delayed by DefaultRetryDelay
 )
 
+// BackupExt is appended to the roster file name to construct the file name of
+// its backup (see Runtime.Backup).
+const BackupExt = ".bak"
+
 // Runtime fine-tunes the construction/verification operations.
+//
+// If HashHead is positive, only the first HashHead bytes of each file (along
+// with the file's size) are used to compute its checksum. This is much faster
+// for large files, but modifications made beyond the first HashHead bytes that
+// do not also change the file's size will go undetected.
+//
+// If HashChunk is positive, files larger than HashChunk bytes are divided into
+// chunks of HashChunk bytes which are hashed concurrently and then combined, so
+// that a single large file does not occupy one worker for the entire scan. The
+// resulting checksum depends on HashChunk and differs from that of a file
+// hashed as a single chunk (see Checksum).
+//
+// Queue is the number of files per thread that may be discovered ahead of the
+// threads processing them, allowing directory traversal to overlap with file
+// hashing. If Queue is not positive, RuntimeQueueDefault is used.
+//
+// If Mmap is positive, files of at least Mmap bytes are mapped into memory and
+// hashed in a single pass instead of being read in small blocks, on platforms
+// that support it. The file is read as usual if it cannot be mapped or if its
+// size changes while mapped. The resulting checksum is the same either way.
+// Mmap does not apply to files hashed with HashHead or HashChunk.
+//
+// If HashBlock is positive, the checksum of each consecutive block of HashBlock
+// bytes of each file is also recorded (see Blocks), computed with the first
+// algorithm of Config.Hash while the file is hashed, so that a file modified
+// only by appending content to it (e.g., a log file) is identified as such (see
+// Status.Appended). HashBlock does not apply to files hashed with HashHead or
+// HashChunk.
+//
+// If UseGitignore is true, the patterns in the .gitignore file (if any) in the
+// roster's directory are also used to exclude files from the roster index.
+// If UseNestedGitignore is true, the patterns in the .gitignore file of every
+// directory traversed, the repository's exclude file, and the user's global
+// git ignore file are all used, with the same precedence as git (see
+// Roster.Gitignore).
+//
+// If MinFileSize or MaxFileSize is positive, files smaller or larger than the
+// respective number of bytes are excluded from the roster index.
+//
+// If Since is not empty, it is a time in RFC 3339 format (see SinceTime), and
+// files last modified before it are excluded from the roster index. Such files
+// are neither hashed nor reported, and their recorded Status is unchanged, so
+// that only recent changes are identified.
+// Similarly, if MinAge or MaxAge is not empty, it is a duration (e.g., "720h";
+// see Ages), and files last modified less or more than the respective duration
+// before the current time are excluded.
+//
+// If BasePath is not empty, it is a relative path prepended to the path of each
+// member as recorded in the roster file (see BasePrefix), so that the rosters of
+// the same content taken from different directories or mount points record
+// their members relative to the same logical root. Otherwise, members are still
+// identified relative to the roster's directory, including by ignore and
+// include patterns. A member recorded without BasePath is recorded with it the
+// next time the roster file is written.
+//
+// If Backup is true, the existing roster file is renamed with extension
+// BackupExt each time it is overwritten, replacing any previous backup.
+//
+// If TempDir is not empty, the temporary file to which the roster file is first
+// written, before it is renamed to replace the roster file, is created in the
+// directory TempDir (relative to the roster's directory, if not absolute)
+// instead of in the roster's directory. If TempDir is on a different file
+// system than the roster file, the temporary file cannot be renamed, so the
+// roster file is instead overwritten with its content, which is not atomic.
+//
+// If Compact is true, each member is written to the roster file with only the
+// attributes compared per Config.Ver, omitting all others, which are considered
+// not recorded (see NoStatus) when the roster file is read. The permissions of
+// directories are always written. If an omitted attribute is later compared,
+// every member is reported as modified until the roster file is updated. It
+// is not applied to roster files stored in SQLite or gob.
+//
+// If TimeZone is not empty, it is the name of the time zone in which the last
+// modification time of each member is written to the roster file, for
+// readability (see Location). Times are always held and compared in UTC, so
+// that TimeZone does not affect which files are identified as modified. It is
+// not applied to roster files stored in SQLite.
+//
+// If IndexDirs is true, directories are indexed along with files, so that the
+// roster index represents the entire directory structure, including empty
+// directories. Directories have no size or checksum (see Status.IsDir).
+//
+// If IndexUnreadable is true, a file whose content cannot be read due to its
+// permissions, though its other attributes can be obtained, is indexed without
+// checksums (see StatusNoCheck) instead of being excluded with an error. Only
+// its other attributes are then compared to identify changes (see Unreadable).
+//
+// If OneFilesystem is true, directories on a different device than the
+// roster's directory (e.g., mount points of network or pseudo file systems) are
+// neither traversed nor indexed, the same as "find -xdev". The recorded files
+// beneath them are considered unknown rather than missing. OneFilesystem has no
+// effect on platforms where the device of a file cannot be determined.
+//
+// If Canonicalize is true, each symbolic link is resolved (see Canonical), and
+// a link referring to another file or directory in the tree is considered an
+// alias of that file, which is indexed under its own path, so that the link is
+// excluded rather than indexed as a separate member. A link that cannot be
+// resolved (e.g., a broken link), or that refers to a file outside of the tree,
+// is indexed as usual. Since symbolic links to directories are never followed,
+// only symbolic links themselves can be aliases, and Canonicalize has no effect
+// unless symbolic links are indexed (see Verify.Link).
+//
+// If Retry is positive, a file that cannot be hashed due to a transient error
+// (see Transient), e.g., on a network file system, is opened and hashed again
+// up to Retry more times before the error is returned. If RetryDelay is not
+// empty, it is the duration (e.g., "250ms") to wait before the first retry, and
+// otherwise DefaultRetryDelay is used (see Backoff). The delay doubles before
+// each subsequent retry. Permanent errors (e.g., a file that no longer exists)
+// are never retried.
+//
+// If Flush is positive and the roster file is stored in SQLite (see
+// FormatSQLiteExt), the members updated during a walk are committed to the
+// roster file every Flush updates, instead of only once the walk completes, so
+// that member data never accumulates in memory. This is intended for very large
+// directory trees. The roster file is then updated even if the walk is stopped
+// by an error, and a read-only walk (e.g., Audit) never commits.
 type Runtime struct {
-	Thr int `yaml:"threads"`
-	Dep int `yaml:"maxdepth"`
+	Thr       int   `yaml:"threads" json:"threads"`
+	Dep       int   `yaml:"maxdepth" json:"maxdepth"`
+	HashHead  int   `yaml:"hashhead" json:"hashhead"`
+	HashChunk int   `yaml:"hashchunk" json:"hashchunk"`
+	Queue     int   `yaml:"queue" json:"queue"`
+	Mmap      int64 `yaml:"mmap" json:"mmap"`
+	HashBlock int   `yaml:"hashblock" json:"hashblock"`
+
+	UseGitignore       bool `yaml:"gitignore" json:"gitignore"`
+	UseNestedGitignore bool `yaml:"gitignorenested" json:"gitignorenested"`
+
+	MinFileSize int64 `yaml:"minfilesize" json:"minfilesize"`
+	MaxFileSize int64 `yaml:"maxfilesize" json:"maxfilesize"`
+
+	Since  string `yaml:"since" json:"since"`
+	MinAge string `yaml:"minage" json:"minage"`
+	MaxAge string `yaml:"maxage" json:"maxage"`
+
+	BasePath string `yaml:"basepath" json:"basepath"`
+
+	Backup  bool   `yaml:"backup" json:"backup"`
+	TempDir string `yaml:"tempdir" json:"tempdir"`
+	Compact bool   `yaml:"compact" json:"compact"`
+
+	TimeZone string `yaml:"timezone" json:"timezone"`
+
+	IndexDirs       bool `yaml:"indexdirs" json:"indexdirs"`
+	IndexUnreadable bool `yaml:"indexunreadable" json:"indexunreadable"`
+	OneFilesystem   bool `yaml:"onefilesystem" json:"onefilesystem"`
+	Canonicalize    bool `yaml:"canonicalize" json:"canonicalize"`
+
+	Retry      int    `yaml:"retry" json:"retry"`
+	RetryDelay string `yaml:"retrydelay" json:"retrydelay"`
+
+	Flush int `yaml:"flush" json:"flush"`
+}
+
+// SizeLimited returns whether or not the receiver Runtime rt excludes files by
+// size.
+func (rt Runtime) SizeLimited() bool {
+	return rt.MinFileSize > RuntimeFileSizeNoLimit ||
+		rt.MaxFileSize > RuntimeFileSizeNoLimit
+}
+
+// KeepSize returns whether or not a file of the given size is within the size
+// limits of the receiver Runtime rt.
+func (rt Runtime) KeepSize(size int64) bool {
+	return (rt.MinFileSize <= RuntimeFileSizeNoLimit || size >= rt.MinFileSize) &&
+		(rt.MaxFileSize <= RuntimeFileSizeNoLimit || size <= rt.MaxFileSize)
+}
+
+// TimeLimited returns whether or not the receiver Runtime rt excludes files by
+// last modification time.
+func (rt Runtime) TimeLimited() bool {
+	return RuntimeSinceNoLimit != rt.Since ||
+		RuntimeAgeNoLimit != rt.MinAge || RuntimeAgeNoLimit != rt.MaxAge
+}
+
+// SinceTime returns the time given by the receiver Runtime rt's Since, or the
+// zero time.Time if Since is empty. Returns an InvalidTimeError if Since is not
+// in RFC 3339 format.
+func (rt Runtime) SinceTime() (time.Time, error) {
+	if RuntimeSinceNoLimit == rt.Since {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, rt.Since)
+	if nil != err {
+		return time.Time{}, InvalidTimeError(rt.Since)
+	}
+	return t, nil
+}
+
+// Ages returns the durations given by the receiver Runtime rt's MinAge and
+// MaxAge, each of which is zero if empty. Returns an InvalidDurationError if
+// either is not a valid, non-negative duration (see time.ParseDuration).
+func (rt Runtime) Ages() (min time.Duration, max time.Duration, err error) {
+	age := func(s string) (time.Duration, error) {
+		if RuntimeAgeNoLimit == s {
+			return 0, nil
+		}
+		d, err := time.ParseDuration(s)
+		if nil != err || d < 0 {
+			return 0, InvalidDurationError(s)
+		}
+		return d, nil
+	}
+	if min, err = age(rt.MinAge); nil != err {
+		return 0, 0, err
+	}
+	if max, err = age(rt.MaxAge); nil != err {
+		return 0, 0, err
+	}
+	return min, max, nil
+}
+
+// KeepMtime returns whether or not a file last modified at the given time is
+// not before the Since time of the receiver Runtime rt, and its age is within
+// the MinAge and MaxAge of rt. Invalid limits are not applied.
+func (rt Runtime) KeepMtime(mtime time.Time) bool {
+	if !rt.TimeLimited() {
+		return true
+	}
+	if since, err := rt.SinceTime(); nil == err && mtime.Before(since) {
+		return false
+	}
+	min, max, err := rt.Ages()
+	if nil != err {
+		return true
+	}
+	age := time.Since(mtime)
+	return (0 == min || age >= min) && (0 == max || age <= max)
+}
+
+// BasePrefix returns the receiver Runtime rt's BasePath, cleaned and with a
+// trailing slash, or an empty string if BasePath is empty. Returns an
+// InvalidPathError if BasePath is absolute or refers to a parent directory.
+func (rt Runtime) BasePrefix() (string, error) {
+	base := path.Clean(filepath.ToSlash(rt.BasePath))
+	switch {
+	case "" == rt.BasePath || "." == base:
+		return "", nil
+	case filepath.IsAbs(rt.BasePath) || path.IsAbs(base) ||
+		".." == base || strings.HasPrefix(base, "../"):
+		return "", InvalidPathError(rt.BasePath)
+	}
+	return base + "/", nil
+}
+
+// Location returns the time zone given by the receiver Runtime rt's TimeZone,
+// which is UTC if TimeZone is empty or "UTC", the system's local time zone if
+// TimeZone is "Local", and otherwise the time zone with the given IANA name
+// (e.g., "America/Chicago"). Returns an InvalidTimeZoneError if no such time
+// zone exists.
+func (rt Runtime) Location() (*time.Location, error) {
+	if RuntimeTimeZoneUTC == rt.TimeZone {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(rt.TimeZone)
+	if nil != err {
+		return nil, InvalidTimeZoneError(rt.TimeZone)
+	}
+	return loc, nil
+}
+
+// Unreadable returns whether or not the given error, returned when computing the
+// checksums of a file, only indicates the file's content cannot be read due to
+// its permissions, and the file is to be indexed without checksums per the
+// receiver Runtime rt (see IndexUnreadable).
+func (rt Runtime) Unreadable(err error) bool {
+	return rt.IndexUnreadable && os.IsPermission(err)
+}
+
+// DefaultRetryDelay is the duration to wait before the first retry of a file
+// that cannot be hashed, if Runtime.RetryDelay is empty.
+const DefaultRetryDelay = 100 * time.Millisecond
+
+// Backoff returns the duration given by the receiver Runtime rt's RetryDelay,
+// or DefaultRetryDelay if RetryDelay is empty. Returns an InvalidDurationError
+// if RetryDelay is not a valid, non-negative duration (see time.ParseDuration).
+func (rt Runtime) Backoff() (time.Duration, error) {
+	if RuntimeRetryDelayNone == rt.RetryDelay {
+		return DefaultRetryDelay, nil
+	}
+	d, err := time.ParseDuration(rt.RetryDelay)
+	if nil != err || d < 0 {
+		return 0, InvalidDurationError(rt.RetryDelay)
+	}
+	return d, nil
+}
+
+// Transient returns whether or not the given error, returned when computing the
+// checksums of a file, may not recur if the file is hashed again (e.g., an I/O
+// error on a network file system), as opposed to a permanent error, such as a
+// file that does not exist or cannot be read due to its permissions.
+func Transient(err error) bool {
+	for _, errno := range []syscall.Errno{
+		syscall.EAGAIN, syscall.EIO, syscall.EINTR, syscall.ETIMEDOUT,
+	} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultRuntime returns the Runtime struct used when creating a new roster
+// file, which has no limits on threads, recursion, or checksum content.
+func DefaultRuntime() Runtime {
+	return Runtime{
+		Thr:       RuntimeThreadsNoLimit,
+		Dep:       RuntimeDepthNoLimit,
+		HashHead:  RuntimeHashHeadNoLimit,
+		HashChunk: RuntimeHashChunkNoLimit,
+		Queue:     RuntimeQueueDefault,
+		Mmap:      RuntimeMmapNever,
+		HashBlock: RuntimeHashBlockNever,
+
+		MinFileSize: RuntimeFileSizeNoLimit,
+		MaxFileSize: RuntimeFileSizeNoLimit,
+
+		Since:  RuntimeSinceNoLimit,
+		MinAge: RuntimeAgeNoLimit,
+		MaxAge: RuntimeAgeNoLimit,
+
+		Backup:  false,
+		Compact: false,
+
+		TimeZone: RuntimeTimeZoneUTC,
+
+		Retry:      RuntimeRetryNever,
+		RetryDelay: RuntimeRetryDelayNone,
+
+		Flush: RuntimeFlushNever,
+	}
+}
+
+// QuickRuntime returns a DefaultRuntime struct modified to compute checksums
+// over only the first head bytes of each file.
+func QuickRuntime(head int) Runtime {
+	rt := DefaultRuntime()
+	rt.HashHead = head
+	return rt
 }
 
 // AllVerify returns a Verify struct with all attributes set true for
 // verification.
 func AllVerify() Verify {
-	return Verify{Fsize: true, Perms: true, Mtime: true, Check: true}
+	return Verify{Fsize: true, Perms: true, Mtime: true, Check: true, Owner: true, Link: true}
+}
+
+// DefaultVerify returns the Verify struct used when creating a new roster file,
+// which identifies changed files by size and checksum only.
+func DefaultVerify() Verify {
+	return Verify{Fsize: true, Perms: false, Mtime: false, Check: true, Owner: false, Link: false}
 }
 
 // Verify defines file attributes that are recorded for all indexed files and
 // used to identify changed files.
+// Symbolic links are only indexed if Link is true, in which case their target
+// path is recorded and compared instead of a checksum.
 type Verify struct {
-	Fsize bool `yaml:"filesize"`
-	Perms bool `yaml:"permissions"`
-	Mtime bool `yaml:"lastmodtime"`
-	Check bool `yaml:"checksum"`
+	Fsize bool `yaml:"filesize" json:"filesize"`
+	Perms bool `yaml:"permissions" json:"permissions"`
+	Mtime bool `yaml:"lastmodtime" json:"lastmodtime"`
+	Check bool `yaml:"checksum" json:"checksum"`
+	Owner bool `yaml:"owner" json:"owner"`
+	Link  bool `yaml:"symlink" json:"symlink"`
 }
 
+// Constants identifying the syntax of Ignore patterns. The syntax of an
+// individual pattern may be given explicitly by prefixing the pattern with the
+// syntax name followed by SyntaxSep, e.g., "glob:*.log".
+// A pattern prefixed with SyntaxNegate (preceding any syntax prefix) is
+// negated, e.g., "!glob:vendor/keep.txt" (see IgnoreRegexp.Match).
+const (
+	SyntaxRegexp  = "regexp" // regular expressions (see package regexp)
+	SyntaxGlob    = "glob"   // shell globs (see globPattern)
+	SyntaxDefault = SyntaxRegexp
+	SyntaxSep     = ":"
+	SyntaxNegate  = "!"
+)
+
 // Ignore stores a list of file patterns to exclude from the roster index.
 type Ignore []string
 
+// IgnorePattern stores a compiled regular expression along with its polarity.
+// A file path matching a negated pattern is exempt from any earlier pattern it
+// also matched.
+type IgnorePattern struct {
+	*regexp.Regexp
+	Negate bool
+	Source string // pattern as originally written, before compilation
+}
+
 // IgnoreRegexp stores a list of compiled regular expressions created from a
 // slice of strings of type Ignore.
-type IgnoreRegexp []*regexp.Regexp
+type IgnoreRegexp []IgnorePattern
+
+// Negated returns whether or not the receiver IgnoreRegexp ire contains any
+// negated patterns.
+func (ire IgnoreRegexp) Negated() bool {
+	for _, pat := range ire {
+		if pat.Negate {
+			return true
+		}
+	}
+	return false
+}
+
+// Last returns the last pattern in the receiver IgnoreRegexp ire matching the
+// given file path, which determines the result of Match, and true. Returns
+// false if no pattern matches.
+func (ire IgnoreRegexp) Last(filePath string) (IgnorePattern, bool) {
+	for i := len(ire) - 1; i >= 0; i-- {
+		if ire[i].MatchString(filePath) {
+			return ire[i], true
+		}
+	}
+	return IgnorePattern{}, false
+}
+
+// Match returns whether or not the given file path is matched by the receiver
+// IgnoreRegexp ire. Patterns are evaluated in order, and the last pattern
+// matching the given file path determines the result.
+func (ire IgnoreRegexp) Match(filePath string) bool {
+	match := false
+	for _, pat := range ire {
+		if pat.MatchString(filePath) {
+			match = !pat.Negate
+		}
+	}
+	return match
+}
+
+// ReadIgnoreFile reads the ignore patterns in the file at the given path, one
+// per line, in the same format as Config.Ign. Blank lines and lines beginning
+// with "#" are skipped, and leading and trailing white space is removed from
+// each pattern.
+func ReadIgnoreFile(filePath string) (Ignore, error) {
+	f, err := os.Open(filePath)
+	if nil != err {
+		return nil, err
+	}
+	defer f.Close()
+
+	ign := Ignore{}
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		line := strings.TrimSpace(scan.Text())
+		if "" == line || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ign = append(ign, line)
+	}
+	if err := scan.Err(); nil != err {
+		return nil, err
+	}
+	return ign, nil
+}
 
 // Compile builds a list of regular expressions from a string slice of ignore
-// patterns.
-func (i Ignore) Compile() (*IgnoreRegexp, error) {
+// patterns, interpreting each pattern without an explicit syntax prefix using
+// the given syntax. If fold is true, each pattern matches regardless of case.
+func (i Ignore) Compile(syntax string, fold bool) (*IgnoreRegexp, error) {
+	flags := ""
+	if fold {
+		flags = "(?i)"
+	}
+	if syntax == "" {
+		syntax = SyntaxDefault
+	}
+	if syntax != SyntaxRegexp && syntax != SyntaxGlob {
+		return nil, fmt.Errorf("invalid ignore syntax: %s", syntax)
+	}
 	ignre := IgnoreRegexp{}
 	for _, ign := range i {
+		src := ign
+		neg := strings.HasPrefix(ign, SyntaxNegate)
+		ign = strings.TrimPrefix(ign, SyntaxNegate)
+		syn := syntax
+		for _, s := range []string{SyntaxRegexp, SyntaxGlob} {
+			if strings.HasPrefix(ign, s+SyntaxSep) {
+				syn, ign = s, strings.TrimPrefix(ign, s+SyntaxSep)
+				break
+			}
+		}
 		// test if provided a string literal (surrounded with backticks)
 		if utf8.RuneCountInString(ign) >= 2 {
 			s, sl := utf8.DecodeRuneInString(ign)
@@ -115,19 +702,22 @@ func (i Ignore) Compile() (*IgnoreRegexp, error) {
 				if !utf8.Valid(b) {
 					return nil, fmt.Errorf("invalid ignore pattern: %s", ign)
 				}
-				re, err := regexp.Compile(regexp.QuoteMeta(string(b)))
+				re, err := regexp.Compile(flags + regexp.QuoteMeta(string(b)))
 				if nil != err {
 					return nil, err
 				}
-				ignre = append(ignre, re)
+				ignre = append(ignre, IgnorePattern{Regexp: re, Negate: neg, Source: src})
 				continue
 			}
 		}
-		re, err := regexp.Compile(ign)
+		if syn == SyntaxGlob {
+			ign = globPattern(ign)
+		}
+		re, err := regexp.Compile(flags + ign)
 		if nil != err {
 			return nil, err
 		}
-		ignre = append(ignre, re)
+		ignre = append(ignre, IgnorePattern{Regexp: re, Negate: neg, Source: src})
 	}
 	return &ignre, nil
 }
@@ -136,6 +726,26 @@ func (i Ignore) Compile() (*IgnoreRegexp, error) {
 // Status struct containing file attributes.
 type Member map[string]Status
 
+// MarshalYAML encodes the receiver Member m as a mapping with keys sorted by
+// file path, so that the roster file content is deterministic.
+func (m Member) MarshalYAML() (interface{}, error) {
+	path := make([]string, 0, len(m))
+	for p := range m {
+		path = append(path, p)
+	}
+	sort.Strings(path)
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, p := range path {
+		val := &yaml.Node{}
+		if err := val.Encode(m[p]); nil != err {
+			return nil, err
+		}
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: p}, val)
+	}
+	return node, nil
+}
+
 // Absent stores a record of all files in the roster, which are removed once the
 // file is discovered.
 type Absent map[string]bool
@@ -146,15 +756,20 @@ const (
 	StatusPermsMask uint64 = 0x00000000FFFFFFFF
 	StatusNoPerms   string = "(none)"
 	StatusNoMtime   string = "(none)"
-	StatusNoCheck   string = ""
+	StatusNoCheck   string = "" // missing checksum (see Checksums.Get)
+	StatusNoOwner   string = "(none)"
 )
 
 // Status represents all verifiable attributes of an indexed file.
 type Status struct {
-	Fsize int64  `yaml:"size"`
-	Perms string `yaml:"perm"`
-	Mtime string `yaml:"last"`
-	Check string `yaml:"hash"`
+	Fsize int64     `yaml:"size" json:"size"`
+	Perms string    `yaml:"perm" json:"perm"`
+	Mtime string    `yaml:"last" json:"last"`
+	Check Checksums `yaml:"hash" json:"hash"`
+	Owner string    `yaml:"own" json:"own"`
+	Link  string    `yaml:"link,omitempty" json:"link,omitempty"`     // symbolic link target path
+	Mode  *FileMode `yaml:"mode,omitempty" json:"mode,omitempty"`     // permission bits of Perms, if recorded
+	Block *Blocks   `yaml:"blocks,omitempty" json:"blocks,omitempty"` // checksum of each block, if recorded
 }
 
 // NoStatus returns a default Status struct for files that have not been
@@ -164,28 +779,127 @@ func NoStatus() Status {
 		Fsize: StatusNoFsize,
 		Perms: StatusNoPerms,
 		Mtime: StatusNoMtime,
-		Check: StatusNoCheck,
+		Check: Checksums{},
+		Owner: StatusNoOwner,
+	}
+}
+
+// MakeStatus constructs a new Status struct, computing a checksum with each of
+// the hash algorithms and the content length given in Config cfg. The
+// attributes obtained from the given os.FileInfo are always recorded, but the
+// checksums are only computed if enabled in the Verify settings of cfg.
+// Otherwise, the file is never opened and no checksums are recorded. No
+// checksums are recorded either if the file cannot be read and the Runtime of
+// cfg permits it (see Runtime.Unreadable).
+func MakeStatus(root string, relPath string, info os.FileInfo, cfg Config) (Status, error) {
+	stat, err := makeStatus(root, relPath, info)
+	if nil != err {
+		return NoStatus(), err
+	}
+	if stat.Check, stat.Block, err = checksum(root, relPath, info, cfg, NoStatus()); nil != err {
+		if !cfg.Rt.Unreadable(err) {
+			return NoStatus(), err
+		}
+		stat.Check, stat.Block = Checksums{}, nil
 	}
+	return stat, nil
 }
 
-// MakeStatus constructs a new Status struct. This method does not consider the
-// Verify settings, and it will always analyze all attributes of the given file.
-func MakeStatus(root string, relPath string, info os.FileInfo) (Status, error) {
+// makeStatus constructs a new Status struct with only the attributes obtained
+// from the given os.FileInfo, which are cheap to obtain compared to checksums.
+func makeStatus(root string, relPath string, info os.FileInfo) (Status, error) {
 	var stat Status
 
 	stat.Fsize = info.Size()
+	if info.IsDir() {
+		// the size of a directory depends on the file system
+		stat.Fsize = 0
+	}
 	stat.Perms = info.Mode().String()
-	stat.Mtime = info.ModTime().Local().String()
+	mode := FileMode(info.Mode().Perm())
+	stat.Mode = &mode
+	stat.Mtime = FormatMtime(info.ModTime())
+	stat.Owner = owner(info)
+	stat.Check = Checksums{}
 
-	// compute checksum
-	var err error
-	if stat.Check, err = Checksum(filepath.Join(root, relPath)); nil != err {
-		return NoStatus(), err
+	// record the target of symbolic links instead of hashing the file
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if stat.Link, err = os.Readlink(filepath.Join(root, relPath)); nil != err {
+			return NoStatus(), err
+		}
 	}
 
 	return stat, nil
 }
 
+// checksum computes the checksums of the given file per Config cfg, or returns
+// empty Checksums if checksums are disabled or the file is a symbolic link or
+// directory. The checksum of each block of the file is also computed, if
+// enabled (see Runtime.HashBlock), and compared with those of the given prior
+// Status of the file, if any. Otherwise, the returned Blocks are nil.
+func checksum(root string, relPath string, info os.FileInfo, cfg Config, prior Status) (
+	Checksums, *Blocks, error,
+) {
+	if !cfg.Ver.Check || info.Mode()&(os.ModeSymlink|os.ModeDir) != 0 {
+		return Checksums{}, nil, nil
+	}
+	var blk *blockWriter
+	if cfg.Rt.HashBlock > RuntimeHashBlockNever && len(cfg.Hash) > 0 {
+		blk = newBlockWriter(int64(cfg.Rt.HashBlock), cfg.Hash[0], prior, info.Size())
+	}
+	sums, blk, err := multiChecksum(filepath.Join(root, relPath), cfg.Rt, blk, cfg.Hash...)
+	if nil != err || nil == blk {
+		return sums, nil, err
+	}
+	return sums, blk.blocks(), nil
+}
+
+// Depth returns the number of path elements in the given relative path, which
+// is the depth of the file relative to the roster's directory.
+func Depth(relPath string) int {
+	return strings.Count(path.Clean(filepath.ToSlash(relPath)), "/") + 1
+}
+
+// Layouts of the last modification time recorded in Status.
+const (
+	// MtimeLayout is the current layout, which is independent of time zone.
+	MtimeLayout = time.RFC3339Nano
+	// MtimeLegacyLayout is the layout of time.Time.String() used by roster
+	// files predating MtimeLayout, which is dependent on local time zone.
+	MtimeLegacyLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+)
+
+// FormatMtime returns the given last modification time formatted in UTC with
+// MtimeLayout.
+func FormatMtime(t time.Time) string {
+	return t.UTC().Format(MtimeLayout)
+}
+
+// normalizeMtime converts the given last modification time, formatted with
+// MtimeLayout in any time zone (see Runtime.TimeZone) or with
+// MtimeLegacyLayout, to the format returned by FormatMtime. Returns the given
+// string unmodified if it is formatted with neither.
+func normalizeMtime(mtime string) string {
+	if t, err := time.Parse(MtimeLayout, mtime); nil == err {
+		return FormatMtime(t)
+	}
+	if t, err := time.Parse(MtimeLegacyLayout, mtime); nil == err {
+		return FormatMtime(t)
+	}
+	return mtime
+}
+
+// displayMtime returns the given last modification time, formatted with
+// FormatMtime, formatted with MtimeLayout in the given time zone instead.
+// Returns the given string unmodified if it is not formatted with MtimeLayout.
+func displayMtime(mtime string, loc *time.Location) string {
+	if t, err := time.Parse(MtimeLayout, mtime); nil == err {
+		return t.In(loc).Format(MtimeLayout)
+	}
+	return mtime
+}
+
 // Valid verifies the receiver Status s is not equal to the unique NoStatus
 // struct, using all Status attributes.
 func (s Status) Valid() bool {
@@ -193,30 +907,80 @@ func (s Status) Valid() bool {
 }
 
 // Equals compares two Status structs for equality, per Verify settings.
+// Only the checksums computed with algorithms common to both are compared (see
+// Checksums.Equals).
+// The Status of a directory only equals that of another directory, and only
+// their permissions and owner are compared, since the size and modification
+// time of a directory change along with its contents.
 func (s Status) Equals(t Status, ver Verify) bool {
+	if s.IsDir() || t.IsDir() {
+		return s.IsDir() == t.IsDir() &&
+			(!ver.Perms || s.PermsEqual(t)) &&
+			(!ver.Owner || s.Owner == t.Owner)
+	}
 	return (!ver.Fsize || s.Fsize == t.Fsize) &&
-		(!ver.Perms || s.Perms == t.Perms) &&
+		(!ver.Perms || s.PermsEqual(t)) &&
 		(!ver.Mtime || s.Mtime == t.Mtime) &&
-		(!ver.Check || s.Check == t.Check)
+		(!ver.Check || s.Check.Equals(t.Check)) &&
+		(!ver.Owner || s.Owner == t.Owner) &&
+		(!ver.Link || s.Link == t.Link)
 }
 
-// Checksum computes the checksum of a file at given path.
-func Checksum(filePath string) (sum string, err error) {
-	f, err := os.Open(filePath)
-	if nil != err {
-		return "", err
+// Diff returns the names of the attributes of the receiver Status s that differ
+// from those of the given Status t, per Verify settings, using the same names
+// as the roster file (e.g., "size" and "hash"), in the order they are recorded.
+// Only the permissions and owner of directories are compared (see Equals).
+// Checksums are only compared if recorded in both, since the checksums of a
+// changed file are not always computed (see ReadOnly). Returns an empty list if
+// no compared attributes differ.
+func (s Status) Diff(t Status, ver Verify) []string {
+	diff := []string{}
+	dir := s.IsDir() || t.IsDir()
+	for _, attr := range []struct {
+		name string
+		diff bool
+	}{
+		{"size", ver.Fsize && !dir && s.Fsize != t.Fsize},
+		{"perm", ver.Perms && !s.PermsEqual(t)},
+		{"last", ver.Mtime && !dir && s.Mtime != t.Mtime},
+		{"hash", ver.Check && !dir && len(s.Check) > 0 && len(t.Check) > 0 &&
+			!s.Check.Equals(t.Check)},
+		{"own", ver.Owner && s.Owner != t.Owner},
+		{"link", ver.Link && !dir && s.Link != t.Link},
+	} {
+		if attr.diff {
+			diff = append(diff, attr.name)
+		}
 	}
-	defer f.Close()
-
-	h := xxhash.New()
+	return diff
+}
 
-	// use io.Copy to stream bytes in file to hashing function
-	if _, err := io.Copy(h, f); nil != err {
-		return "", err
+// PermsEqual compares the permissions of two Status structs. The numeric
+// permission bits (see Status.Mode) are compared if recorded in both, so that
+// only the permissions themselves are compared, regardless of file type.
+// Otherwise, the permission strings are compared, such as with a Status
+// recorded before the numeric permission bits were recorded.
+func (s Status) PermsEqual(t Status) bool {
+	if nil != s.Mode && nil != t.Mode {
+		return *s.Mode == *t.Mode
 	}
+	return s.Perms == t.Perms
+}
 
-	// convert resulting hash to hex string
-	return strconv.FormatUint(h.Sum64(), 16), nil
+// IsDir returns whether or not the receiver Status s is that of a directory,
+// which has no size or checksum (see Runtime.IndexDirs).
+func (s Status) IsDir() bool {
+	return strings.HasPrefix(s.Perms, "d")
+}
+
+// Complete verifies the receiver Status s has a recorded value for each of the
+// attributes enabled in the given Verify settings.
+func (s Status) Complete(ver Verify) bool {
+	return (!ver.Fsize || s.Fsize != StatusNoFsize) &&
+		(!ver.Perms || (s.Perms != StatusNoPerms && s.Perms != "")) &&
+		(!ver.Mtime || (s.Mtime != StatusNoMtime && s.Mtime != "")) &&
+		(!ver.Check || len(s.Check) > 0 || s.Link != "" || s.IsDir()) &&
+		(!ver.Owner || (s.Owner != StatusNoOwner && s.Owner != ""))
 }
 
 // New constructs a new roster file at the given file path, initialized with all
@@ -228,29 +992,48 @@ func New(fileExists bool, filePath string) *Roster {
 	ire := &IgnoreRegexp{}
 	if !fileExists {
 		ign = &IgnoreDefault
-		ire, _ = ign.Compile()
+		ire, _ = ign.Compile(SyntaxDefault, false)
 	}
 	return &Roster{
 		path:  filePath,
+		self:  filepath.Base(filePath),
 		memlk: sync.Mutex{},
-		abslk: sync.Mutex{},
 		Cfg: Config{
-			Rt: Runtime{
-				Thr: RuntimeThreadsNoLimit,
-				Dep: RuntimeDepthNoLimit,
-			},
-			Ver: Verify{
-				Fsize: true,
-				Perms: false,
-				Mtime: false,
-				Check: true,
-			},
-			Ign: *ign,
-			ire: *ire,
+			Rt:   DefaultRuntime(),
+			Ver:  DefaultVerify(),
+			Hash: Hash{HashDefault},
+			Ign:  *ign,
+			Inc:  Ignore{},
+			Syn:  SyntaxDefault,
+			ire:  *ire,
+			icr:  IgnoreRegexp{},
+			Perm: FileMode(Permissions),
 		},
-		Mem: Member{},
-		abs: Absent{},
+		Mem:    Member{},
+		mem:    newShards(),
+		sql:    FormatSQLite == FormatOf(filePath),
+		git:    IgnoreRegexp{},
+		gitDir: map[string]bool{},
+	}
+}
+
+// DefaultConfig returns the configuration of a new roster file, the same as
+// that of a Roster returned by New for a roster file that does not exist.
+func DefaultConfig() Config {
+	return New(false, "").Cfg
+}
+
+// NewWithConfig constructs a new roster file at the given file path, the same as
+// New, but with the given configuration, which is validated and compiled the
+// same as if it were parsed from the roster file.
+// Returns a nil Roster and descriptive error if the configuration is invalid.
+func NewWithConfig(filePath string, cfg Config) (*Roster, error) {
+	ros := New(false, filePath)
+	ros.Cfg = cfg
+	if err := ros.init(); nil != err {
+		return nil, err
 	}
+	return ros, nil
 }
 
 // Parse parses the roster configuration and member data from a given roster
@@ -267,6 +1050,7 @@ func Parse(filePath string) (*Roster, error) {
 		return nil, InvalidPathError(dir)
 	}
 
+	var err error
 	fstat, ferr := os.Stat(filePath)
 	if os.IsNotExist(ferr) {
 		// create a new default roster file if one does not exist
@@ -275,97 +1059,700 @@ func Parse(filePath string) (*Roster, error) {
 		return nil, NotRegularFileError(filePath)
 	}
 
-	data, err := ioutil.ReadFile(filePath)
-	if err != nil {
+	ros := New(true, filePath)
+	if FormatSQLite == FormatOf(filePath) {
+		// members remain in the database, only the configuration is decoded
+		if ros.db, err = openSQLite(filePath); nil != err {
+			return nil, err
+		}
+		if err := ros.db.config(&ros.Cfg); nil != err {
+			ros.Close()
+			return nil, err
+		}
+	} else if err := ros.decode(); nil != err {
+		return nil, err
+	}
+
+	if err := ros.init(); nil != err {
+		ros.Close()
 		return nil, err
 	}
 
+	return ros, nil
+}
+
+// ParseReader parses the roster configuration and member data from the given
+// io.Reader into the returned Roster struct, the same as Parse, as if read from
+// a roster file with the given path, which determines its Format and the
+// directory of its .gitignore file (see Runtime.UseGitignore), but is otherwise
+// never read or written. Returns a Roster struct with default configuration and
+// empty member data if the io.Reader is empty. Roster files stored in SQLite
+// cannot be parsed from an io.Reader.
+func ParseReader(r io.Reader, filePath string) (*Roster, error) {
+	if FormatSQLite == FormatOf(filePath) {
+		return nil, UnsupportedFormatError(FormatSQLite.String())
+	}
+	br := bufio.NewReader(r)
+	if _, err := br.Peek(1); io.EOF == err {
+		return New(false, filePath), nil
+	}
 	ros := New(true, filePath)
-	err = yaml.Unmarshal(data, ros)
-	if err != nil {
+	if err := ros.decodeFrom(br); nil != err {
 		return nil, err
 	}
+	if err := ros.init(); nil != err {
+		return nil, err
+	}
+	return ros, nil
+}
 
-	ire, err := ros.Cfg.Ign.Compile()
+// init validates and compiles the configuration of the receiver Roster ros, and
+// prepares its members, once decoded from its roster file.
+func (ros *Roster) init() error {
+	dir := filepath.Dir(ros.path)
+	var err error
+
+	// roster files created before the hash setting existed used xxhash only
+	if len(ros.Cfg.Hash) == 0 {
+		ros.Cfg.Hash = Hash{HashXXHash}
+	}
+	if err := ros.Cfg.Hash.Validate(); nil != err {
+		return err
+	}
+	if _, err := ros.Cfg.Rt.SinceTime(); nil != err {
+		return err
+	}
+	if _, _, err := ros.Cfg.Rt.Ages(); nil != err {
+		return err
+	}
+	if _, err := ros.Cfg.Rt.Location(); nil != err {
+		return err
+	}
+	if _, err := ros.Cfg.Rt.Backoff(); nil != err {
+		return err
+	}
+	if ros.base, err = ros.Cfg.Rt.BasePrefix(); nil != err {
+		return err
+	}
+	if nil != ros.db {
+		if err := ros.db.rebase(ros.base); nil != err {
+			return err
+		}
+	}
+
+	ire, err := ros.Cfg.Ign.Compile(ros.Cfg.Syn, ros.Cfg.IgnoreCaseInsensitive)
 	if nil != err {
-		return nil, err
+		return err
 	}
 	ros.Cfg.ire = *ire
 
-	// initialize absentee list
-	for mem := range ros.Mem {
-		inc := true
-		// if files previously added to roster are now on the ignore list, skip
-		// adding them to the absentee list
-		for _, ire := range ros.Cfg.ire {
-			if ire.MatchString(mem) {
-				inc = false
-				break
-			}
+	// patterns from the ignore file precede the configured ignore patterns,
+	// and are read again each time the roster file is parsed
+	if "" != ros.Cfg.IgnoreFile {
+		ignFile := ros.Cfg.IgnoreFile
+		if !filepath.IsAbs(ignFile) {
+			ignFile = filepath.Join(dir, ignFile)
+		}
+		ign, err := ReadIgnoreFile(ignFile)
+		if nil != err {
+			return err
 		}
-		if inc {
-			ros.abs[mem] = true
+		ext, err := ign.Compile(ros.Cfg.Syn, ros.Cfg.IgnoreCaseInsensitive)
+		if nil != err {
+			return err
+		}
+		for i := range *ext {
+			(*ext)[i].Source += " (" + ros.Cfg.IgnoreFile + ")"
 		}
+		ros.Cfg.ire = append(*ext, ros.Cfg.ire...)
 	}
 
-	return ros, nil
+	// patterns from .gitignore precede the configured ignore patterns
+	if ros.Cfg.Rt.UseGitignore {
+		git, err := FromGitignore(filepath.Join(dir, GitignoreFileName))
+		if nil != err && !os.IsNotExist(err) {
+			return err
+		}
+		if nil == err {
+			ros.git = *git
+		}
+		ros.gitDir["."] = true
+	}
+
+	icr, err := ros.Cfg.Inc.Compile(ros.Cfg.Syn, ros.Cfg.IgnoreCaseInsensitive)
+	if nil != err {
+		return err
+	}
+	ros.Cfg.icr = *icr
+
+	norm := Member{}
+	for mem, stat := range ros.Mem {
+		// convert mtime recorded in any time zone to UTC
+		if mtime := normalizeMtime(stat.Mtime); mtime != stat.Mtime {
+			stat.Mtime = mtime
+			ros.Mem[mem] = stat
+		}
+		// convert paths recorded with the OS path separator to forward slashes
+		if key := filepath.ToSlash(mem); key != mem {
+			norm[key] = stat
+			delete(ros.Mem, mem)
+		}
+	}
+	for mem, stat := range norm {
+		ros.Mem[mem] = stat
+	}
+	// members are only held in Mem while encoded or decoded, and are held in
+	// memory relative to the roster's directory
+	ros.mem.load(ros.Mem, ros.base)
+	ros.Mem = Member{}
+
+	// initialize absentee list
+	ros.ResetAbsent()
+
+	return nil
+}
+
+// decode decodes the receiver Roster ros's configuration and member data from
+// its roster file.
+func (ros *Roster) decode() error {
+	f, err := os.Open(ros.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return ros.decodeFrom(f)
+}
+
+// decodeFrom decodes the receiver Roster ros's configuration and member data
+// from the given io.Reader, in the Format of its roster file.
+func (ros *Roster) decodeFrom(f io.Reader) error {
+	// gzip-compressed roster files are detected by content, not file name
+	r, err := decompress(f)
+	if err != nil {
+		return err
+	}
+
+	format := FormatOf(ros.path)
+	if FormatGob == format {
+		// gob does not encode zero values, so they must not be replaced with the
+		// default values of a new roster
+		ros.Cfg, ros.Mem = Config{}, Member{}
+	}
+	// decode directly from the file, so that its entire content is never held
+	// in memory alongside the decoded roster; an empty file is a valid roster
+	err = format.Decode(r, ros)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// ResetAbsent rebuilds the list of recorded files expected to be found, which
+// depends on the receiver Roster ros's Runtime configuration. It must be called
+// after modifying the Runtime configuration of a parsed Roster.
+func (ros *Roster) ResetAbsent() {
+	// if files previously added to roster are now beyond the maximum depth,
+	// outside the size limits, on the ignore list, or not on the include list,
+	// skip adding them to the absentee list
+	keep := func(filePath string, stat Status) bool {
+		inc := RuntimeDepthNoLimit == ros.Cfg.Rt.Dep || Depth(filePath) <= ros.Cfg.Rt.Dep
+		return inc && (StatusNoFsize == stat.Fsize || stat.IsDir() || ros.Cfg.Rt.KeepSize(stat.Fsize)) &&
+			!ros.Ignored(filePath) && ros.Included(filePath)
+	}
+	if nil != ros.db {
+		// the absentee list of a database is kept in the database
+		ros.memlk.Lock()
+		defer ros.memlk.Unlock()
+		ros.db.resetAbsent(keep)
+		return
+	}
+	ros.mem.resetAbsent(keep)
+}
+
+// Marshal returns the receiver Roster ros's configuration and member data
+// formatted exactly as Write would write it to disk, but without compression.
+func (ros *Roster) Marshal() ([]byte, error) {
+	return FormatOf(ros.path).Marshal(ros.encoded())
+}
+
+// encoded returns a Roster containing the receiver Roster ros's configuration
+// and a copy of all its members in Mem, as they are encoded in a roster file,
+// or the equivalent compact encoding if Runtime.Compact is enabled.
+func (ros *Roster) encoded() interface{} {
+	defer ros.lock()()
+	mem := Member{}
+	if nil != ros.db {
+		// members stored in a database are encoded the same as those in memory
+		for _, filePath := range ros.db.Members() {
+			mem[ros.base+filePath], _ = ros.db.Status(filePath)
+		}
+	} else {
+		for filePath, stat := range ros.mem.member() {
+			mem[ros.base+filePath] = stat
+		}
+	}
+	// mtimes are held in UTC, and only written in another time zone
+	if loc, err := ros.Cfg.Rt.Location(); nil == err && time.UTC != loc {
+		for filePath, stat := range mem {
+			stat.Mtime = displayMtime(stat.Mtime, loc)
+			mem[filePath] = stat
+		}
+	}
+	// gob omits only zero values, which are not equal to NoStatus
+	if ros.Cfg.Rt.Compact && FormatGob != FormatOf(ros.path) {
+		return compacted(ros.Cfg, mem)
+	}
+	return &Roster{Cfg: ros.Cfg, Mem: mem}
 }
 
 // Write formats and writes the receiver Roster ros's configuration and member
-// data to disk. Returns an error if formatting or writing fails.
+// data to disk, in the Format identified by its file name extension, and with
+// gzip compression if its file name has extension FormatGzipExt. Returns an
+// error if formatting or writing fails.
 func (ros *Roster) Write() error {
-	data, err := yaml.Marshal(ros)
+	if FormatSQLite == FormatOf(ros.path) {
+		return ros.commit()
+	}
+	data, err := ros.Marshal()
+	if nil != err {
+		return err
+	}
+	return ros.write(data)
+}
+
+// write writes the given formatted data to disk as the receiver Roster ros's
+// roster file, with gzip compression if its file name has extension
+// FormatGzipExt.
+func (ros *Roster) write(data []byte) error {
+	data, err := ros.compress(data)
 	if nil != err {
 		return err
 	}
-	return ioutil.WriteFile(ros.path, data, Permissions)
+	backup := ""
+	if ros.Cfg.Rt.Backup {
+		backup = ros.path + BackupExt
+	}
+	perm := os.FileMode(ros.Cfg.Perm)
+	if 0 == perm {
+		perm = Permissions
+	}
+	temp := ros.Cfg.Rt.TempDir
+	if "" != temp && !filepath.IsAbs(temp) {
+		temp = filepath.Join(filepath.Dir(ros.path), temp)
+	}
+	return writeFile(ros.path, temp, backup, data, perm)
+}
+
+// WriteTo writes the receiver Roster ros's configuration and member data to the
+// given io.Writer, formatted and compressed the same as Write, instead of to its
+// roster file, and returns the number of bytes written. Roster files stored in
+// SQLite cannot be written to an io.Writer.
+func (ros *Roster) WriteTo(w io.Writer) (int64, error) {
+	if ros.sql {
+		return 0, UnsupportedFormatError(FormatSQLite.String())
+	}
+	data, err := ros.Marshal()
+	if nil != err {
+		return 0, err
+	}
+	if data, err = ros.compress(data); nil != err {
+		return 0, err
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+// compress returns the given formatted data compressed with gzip if the
+// receiver Roster ros's file name has extension FormatGzipExt, or otherwise
+// returns the given data unmodified.
+func (ros *Roster) compress(data []byte) ([]byte, error) {
+	if Compressed(ros.path) {
+		return compress(data)
+	}
+	return data, nil
+}
+
+// commit writes all changes to the receiver Roster ros's configuration and
+// member data to its SQLite database, creating the database if it does not
+// exist.
+func (ros *Roster) commit() error {
+	if err := ros.open(); nil != err {
+		return err
+	}
+	ros.pend = 0
+	perm := os.FileMode(ros.Cfg.Perm)
+	if 0 == perm {
+		perm = Permissions
+	}
+	return ros.db.commit(ros.Cfg, perm, ros.path)
+}
+
+// flush commits the members updated in the receiver Roster ros to its SQLite
+// database, creating the database if it does not exist, without storing the
+// roster configuration (see Runtime.Flush). The caller must hold memlk.
+func (ros *Roster) flush() error {
+	if err := ros.open(); nil != err {
+		return err
+	}
+	ros.pend = 0
+	return ros.db.flush()
+}
+
+// open creates the SQLite database of the receiver Roster ros, if it has not
+// been opened, and moves all members held in memory into the database. Members
+// of a new roster are held in memory until first written, so that a roster file is
+// never created merely by reading it.
+func (ros *Roster) open() error {
+	if nil != ros.db {
+		return nil
+	}
+	db, err := openSQLite(ros.path)
+	if nil != err {
+		return err
+	}
+	if err := db.rebase(ros.base); nil != err {
+		db.close()
+		return err
+	}
+	mem, abs := ros.mem.member(), ros.mem.absentees()
+	for filePath, stat := range mem {
+		if err := db.Update(filePath, stat); nil != err {
+			db.close()
+			return err
+		}
+	}
+	// the absentee list moves along with the members
+	for _, filePath := range abs {
+		db.absent(filePath)
+	}
+	ros.mem.clear()
+	ros.db = db
+	return nil
+}
+
+// writeFile writes the given data to a temporary file in the given directory, or
+// in the same directory as the given file path if empty, and then renames the
+// temporary file to the given file path, so that the file at the given path is
+// never partially written. If the given backup path is not empty, any existing
+// file at the given file path is first renamed to the backup path. If the
+// temporary file cannot be renamed because it is on a different file system,
+// the given data is instead written directly to the given file path.
+func writeFile(filePath string, temp string, backup string, data []byte, perm os.FileMode) error {
+	if "" == temp {
+		temp = filepath.Dir(filePath)
+	}
+	tmp, err := ioutil.TempFile(temp, "."+filepath.Base(filePath)+".*")
+	if nil != err {
+		return err
+	}
+	// remove the temporary file if it was not renamed
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); nil != err {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); nil != err {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); nil != err {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); nil != err {
+		return err
+	}
+	if backup != "" {
+		if err := os.Rename(filePath, backup); nil != err && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	err = os.Rename(tmp.Name(), filePath)
+	if errors.Is(err, syscall.EXDEV) {
+		return overwriteFile(filePath, data, perm)
+	}
+	return err
+}
+
+// overwriteFile writes the given data to the given file path, replacing the
+// content of any existing file, and sets its permissions.
+func overwriteFile(filePath string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if nil != err {
+		return err
+	}
+	if _, err := f.Write(data); nil != err {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); nil != err {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); nil != err {
+		return err
+	}
+	return os.Chmod(filePath, perm)
 }
 
 // Status checks if the given file path exists in the index and returns its
 // corresponding Status struct and true. If the file path does not exist, it
 // returns the unique NoStatus struct and false.
 func (ros *Roster) Status(filePath string) (Status, bool) {
-	ros.memlk.Lock()
-	defer ros.memlk.Unlock()
-	if stat, ok := ros.Mem[filePath]; ok {
-		return stat, true
-	} else {
-		return NoStatus(), false
-	}
+	defer ros.lock()()
+	return ros.store().Status(filePath)
 }
 
 // Keep returns whether or not a file with the given path should be considered
-// candidate for indexing. Directories, files matching an ignore pattern, and
-// the roster index file itself all return false.
-func (ros *Roster) Keep(filePath string, info os.FileInfo) bool {
-	if uint32(info.Mode()&os.ModeType) != 0 {
+// candidate for indexing, given its file mode (of which only the type bits are
+// considered). Directories, files matching an ignore pattern, files not
+// matching any include pattern (if any are defined), and the roster index file
+// itself (and its backup) all return false. Symbolic links return false unless
+// link verification is enabled, and directories other than the root directory
+// return false unless Runtime.IndexDirs is enabled.
+func (ros *Roster) Keep(filePath string, mode os.FileMode) bool {
+	if uint32(ros.keepType(mode)) != 0 {
+		return false
+	}
+	if mode.IsDir() && path.Clean(filepath.ToSlash(filePath)) == "." {
+		return false
+	}
+	if ros.IsSelf(filePath) {
+		return false
+	}
+	return !ros.Ignored(filePath) && ros.Included(filePath)
+}
+
+// keepType returns the type bits of the given file mode, excluding those of the
+// file types indexed per the receiver Roster ros's configuration, so that the
+// result is zero if files of the given type are indexed.
+func (ros *Roster) keepType(mode os.FileMode) os.FileMode {
+	mode &= os.ModeType
+	if ros.Cfg.Ver.Link {
+		mode &^= os.ModeSymlink
+	}
+	if ros.Cfg.Rt.IndexDirs {
+		mode &^= os.ModeDir
+	}
+	return mode
+}
+
+// SetRoot sets the root directory of the tree indexed by the receiver Roster
+// ros, relative to which all file paths are given. By default, the root is the
+// directory containing the roster file.
+func (ros *Roster) SetRoot(root string) {
+	ros.self, ros.root = "", ""
+	abs, err := filepath.Abs(ros.path)
+	if nil != err {
+		return
+	}
+	if root, err = filepath.Abs(root); nil != err {
+		return
+	}
+	ros.root = filepath.ToSlash(root)
+	rel, err := filepath.Rel(root, abs)
+	if nil != err || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return // roster file is outside of the tree, never encountered
+	}
+	ros.self = filepath.ToSlash(rel)
+}
+
+// AbsPath returns the absolute path, with slash separators, of the given file
+// path relative to the root directory (see SetRoot), preserving any trailing
+// separator, or an empty string if the root directory has not been set.
+func (ros *Roster) AbsPath(filePath string) string {
+	if "" == ros.root {
+		return ""
+	}
+	filePath = filepath.ToSlash(filePath)
+	if "" == filePath || "." == filePath {
+		return ros.root
+	}
+	return strings.TrimSuffix(ros.root, "/") + "/" + filePath
+}
+
+// Canonical returns the given file path, relative to the root directory (see
+// SetRoot), with all symbolic links resolved (see filepath.EvalSymlinks), also
+// relative to the root directory and with slash separators. Returns the given
+// file path unmodified if it cannot be resolved (e.g., a broken link), if it
+// resolves to a path outside of the root directory, or if the root directory
+// has not been set.
+func (ros *Roster) Canonical(filePath string) string {
+	if "" == ros.root {
+		return filePath
+	}
+	root, err := filepath.EvalSymlinks(filepath.FromSlash(ros.root))
+	if nil != err {
+		return filePath
+	}
+	res, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(filePath)))
+	if nil != err {
+		return filePath
+	}
+	rel, err := filepath.Rel(root, res)
+	if nil != err || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filePath
+	}
+	return filepath.ToSlash(rel)
+}
+
+// IsSelf returns whether or not the given file path, relative to the root
+// directory (see SetRoot), is the receiver Roster ros's own roster file or its
+// backup.
+func (ros *Roster) IsSelf(filePath string) bool {
+	if ros.self == "" {
 		return false
 	}
-	if filepath.Base(filePath) == filepath.Base(ros.path) {
+	filePath = path.Clean(filepath.ToSlash(filePath))
+	if filePath == ros.self || filePath == ros.self+BackupExt {
+		return true
+	}
+	if FormatSQLite == FormatOf(ros.path) {
+		for _, ext := range sqliteTemp {
+			if filePath == ros.self+ext {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Ignored returns whether or not the given file path matches the ignore
+// patterns in the receiver Roster ros's configuration (see IgnoreRegexp.Match),
+// or the git ignore patterns added to ros (see Gitignore), which precede them.
+// If Config.IgnoreAbsolute is enabled, the configured ignore patterns are also
+// matched against the absolute path of the file (see AbsPath); otherwise, all
+// patterns are only matched against the given relative path.
+func (ros *Roster) Ignored(filePath string) bool {
+	pat, ok := ros.lastIgnore(filePath)
+	return ok && !pat.Negate
+}
+
+// IgnoredDir returns whether or not the directory with the given path can be
+// excluded from traversal entirely, because it matches the ignore patterns in
+// the receiver Roster ros's configuration. Directories are never excluded if
+// any negated ignore patterns exist, since those patterns may exempt files
+// beneath an ignored directory.
+func (ros *Roster) IgnoredDir(dirPath string) bool {
+	ros.gitlk.RLock()
+	negated := ros.git.Negated()
+	ros.gitlk.RUnlock()
+	if negated || ros.Cfg.ire.Negated() {
 		return false
 	}
-	for _, ire := range ros.Cfg.ire {
-		if ire.MatchString(filePath) {
-			return false
+	// also match patterns that match directories exclusively (see globPattern)
+	return ros.Ignored(dirPath) || ros.Ignored(dirPath+"/")
+}
+
+// SkipReason returns a description of the reason the given file path with the
+// given file mode is not a candidate for indexing (see Keep), including the
+// pattern responsible if it is ignored, or an empty string if it is a candidate.
+func (ros *Roster) SkipReason(filePath string, mode os.FileMode) string {
+	if ros.Keep(filePath, mode) {
+		return ""
+	}
+	if uint32(ros.keepType(mode)) != 0 {
+		return "not a regular file"
+	}
+	if mode.IsDir() {
+		return "root directory"
+	}
+	if ros.IsSelf(filePath) {
+		return "roster file"
+	}
+	if pat, ok := ros.lastIgnore(filePath); ok && !pat.Negate {
+		return "ignored by pattern " + pat.Source
+	}
+	return "not matched by any include pattern"
+}
+
+// SkipDirReason returns a description of the reason the directory with the
+// given path is excluded from traversal (see IgnoredDir), including the pattern
+// responsible, or an empty string if it is not excluded.
+func (ros *Roster) SkipDirReason(dirPath string) string {
+	if !ros.IgnoredDir(dirPath) {
+		return ""
+	}
+	for _, p := range []string{dirPath, dirPath + "/"} {
+		if pat, ok := ros.lastIgnore(p); ok && !pat.Negate {
+			return "ignored by pattern " + pat.Source
 		}
 	}
-	return true
+	return "ignored"
+}
+
+// Included returns whether or not the given file path matches any of the
+// include patterns in the receiver Roster ros's configuration, or true if no
+// include patterns are defined. Include patterns are only matched against the
+// given relative path, regardless of Config.IgnoreAbsolute.
+func (ros *Roster) Included(filePath string) bool {
+	return len(ros.Cfg.icr) == 0 || ros.Cfg.icr.Match(filePath)
 }
 
 // Changed determines if the given file path and os.FileInfo already exists in
 // the roster index, computes the Status struct for the given file, and returns
 // whether it is a new file, whether the Status info has changed, and what the
 // new Status is, along with any error encountered.
+// If the receiver Roster ros is ReadOnly, an existing file is not hashed if a
+// cheaper verified attribute (e.g., its size) already changed, unless the
+// checksums of its blocks were recorded, so the returned Status then has no
+// checksums. Otherwise, a changed file is always hashed, since its checksums
+// are recorded by Update.
 func (ros *Roster) Changed(root string, relPath string, info os.FileInfo) (
 	new bool, changed bool, stat Status, err error,
 ) {
 	prev, ok := ros.Status(relPath)
-	stat, err = MakeStatus(root, relPath, info)
-	if ok && prev.Valid() {
-		return false, !prev.Equals(stat, ros.Cfg.Ver), stat, err
-	} else {
+	if !ok || !prev.Valid() {
+		stat, err = MakeStatus(root, relPath, info, ros.Cfg)
 		return true, false, stat, err
 	}
+	if stat, err = makeStatus(root, relPath, info); nil != err {
+		return false, false, stat, err
+	}
+	// compare the cheaper attributes first, so that a file whose size (e.g.)
+	// has changed is not also hashed merely to detect the change. The checksums
+	// are still computed if they will be recorded, or to identify appended
+	// content if the checksums of its blocks were recorded.
+	cheap := ros.Cfg.Ver
+	cheap.Check = false
+	blocks := nil != prev.Block && ros.Cfg.Rt.HashBlock > RuntimeHashBlockNever
+	if !prev.Equals(stat, cheap) && ros.ro && !blocks {
+		return false, true, stat, nil
+	}
+	if stat.Check, stat.Block, err = checksum(root, relPath, info, ros.Cfg, prev); nil != err {
+		if !ros.Cfg.Rt.Unreadable(err) {
+			return false, false, NoStatus(), err
+		}
+		// the file is indexed without checksums, which are not compared
+		stat.Check, stat.Block = Checksums{}, nil
+		return false, !prev.Equals(stat, cheap), stat, nil
+	}
+	// content appended along with changes to other attributes is not
+	// identified as appended
+	if stat.Appended() {
+		same := ros.Cfg.Ver
+		same.Fsize, same.Mtime, same.Check = false, false, false
+		stat.Block.app = prev.Equals(stat, same)
+	}
+	// checksums recorded with different HashHead or HashChunk settings are
+	// compared with checksums computed the same way, so that changing either
+	// setting does not report every file as modified. The returned Status has
+	// the checksums computed per the current settings, which are recorded.
+	cmp := stat
+	if ros.Cfg.Ver.Check && !stat.Check.Comparable(prev.Check) {
+		rt := ros.Cfg.Rt.hashedAs(prev.Check)
+		if cmp.Check, _, err = multiChecksum(
+			filepath.Join(root, relPath), rt, nil, ros.Cfg.Hash...); nil != err {
+			return false, false, NoStatus(), err
+		}
+	}
+	return false, !prev.Equals(cmp, ros.Cfg.Ver), stat, nil
+}
+
+// ReadOnly indicates the receiver Roster ros will not be written, so that
+// checksums of existing files are only computed when needed to detect changes.
+// The Status of a changed file may therefore have no checksums.
+func (ros *Roster) ReadOnly() {
+	ros.ro = true
 }
 
 // Update replaces the Status struct associated with a given file path in the
@@ -375,36 +1762,227 @@ func (ros *Roster) Update(filePath string, stat Status) error {
 		return errors.New("invalid member status")
 	}
 
+	// members held in memory are only locked by shard, so that concurrent
+	// updates of different files rarely contend for the same lock
+	defer ros.lock()()
+	if nil == ros.db {
+		ros.mem.update(filePath, stat)
+	} else {
+		if prior, ok := ros.db.Status(filePath); ok && !prior.Equals(stat, AllVerify()) {
+			ros.db.setPrior(filePath, prior)
+		}
+		if err := ros.db.Update(filePath, stat); nil != err {
+			return err
+		}
+		ros.db.present(filePath)
+	}
+	if ros.sql && ros.Cfg.Rt.Flush > RuntimeFlushNever && !ros.ro {
+		if ros.pend++; ros.pend >= ros.Cfg.Rt.Flush {
+			return ros.flush()
+		}
+	}
+	return nil
+}
+
+// lock locks memlk if the members of the receiver Roster ros are or may be
+// stored in a database, and returns the function that unlocks it. Otherwise,
+// members are held in memory, guarded by the lock of each shard instead, and
+// the returned function does nothing.
+func (ros *Roster) lock() func() {
+	if !ros.sql {
+		return func() {}
+	}
 	ros.memlk.Lock()
-	ros.Mem[filePath] = stat
-	ros.memlk.Unlock()
+	return ros.memlk.Unlock
+}
 
-	ros.abslk.Lock()
-	if _, ok := ros.abs[filePath]; ok {
-		delete(ros.abs, filePath)
+// lockPair locks the receiver Roster ros and the given Roster oth the same as
+// lock, always in order of their addresses, so that two rosters locked together
+// concurrently in opposite order never deadlock, and only once if they are the
+// same roster. Returns the function that unlocks both.
+func (ros *Roster) lockPair(oth *Roster) func() {
+	if oth == ros {
+		return ros.lock()
 	}
-	ros.abslk.Unlock()
+	a, b := ros, oth
+	if uintptr(unsafe.Pointer(b)) < uintptr(unsafe.Pointer(a)) {
+		a, b = b, a
+	}
+	unlockA := a.lock()
+	unlockB := b.lock()
+	return func() {
+		unlockB()
+		unlockA()
+	}
+}
 
-	return nil
+// Present marks the given file path as found without updating its Status, so
+// that it is not reported as missing. This is used for recorded files that are
+// found but are no longer candidates for indexing.
+func (ros *Roster) Present(filePath string) {
+	defer ros.lock()()
+	if nil != ros.db {
+		ros.db.present(filePath)
+		return
+	}
+	ros.mem.present(filePath)
+}
+
+// PresentDir marks all file paths in the given directory path (recursively) as
+// found without updating their Status, the same as Present. This is used for
+// directories that cannot be read.
+func (ros *Roster) PresentDir(dirPath string) {
+	prefix := strings.TrimSuffix(dirPath, "/") + "/"
+	defer ros.lock()()
+	if nil != ros.db {
+		ros.db.presentDir(prefix)
+		return
+	}
+	ros.mem.presentDir(prefix)
 }
 
 // Expel removes the given file path from the receiver Roster ros.
 func (ros *Roster) Expel(filePath string) {
-	ros.memlk.Lock()
-	defer ros.memlk.Unlock()
-	if _, ok := ros.Mem[filePath]; ok {
-		delete(ros.Mem, filePath)
+	defer ros.lock()()
+	if nil == ros.db {
+		ros.mem.expel(filePath)
+		return
+	}
+	if prior, ok := ros.db.Status(filePath); ok {
+		ros.db.setPrior(filePath, prior)
+		ros.db.Expel(filePath)
 	}
 }
 
+// Prior returns the Status struct associated with a given file path before it
+// was last replaced by Update or removed by Expel, and true. If the file path's
+// Status was never replaced or removed, it returns the unique NoStatus struct
+// and false.
+func (ros *Roster) Prior(filePath string) (Status, bool) {
+	defer ros.lock()()
+	// members replaced before the database was opened have their prior Status
+	// held in memory
+	if nil != ros.db {
+		if prior, ok := ros.db.prior(filePath); ok {
+			return prior, true
+		}
+	}
+	return ros.mem.prior(filePath)
+}
+
+// Diff compares the members of the given Rosters a and b, treating a as the
+// original and b as the current roster, and returns sorted lists of the files
+// found only in b, the files found only in a, and the files found in both whose
+// Status differ per the given Verify settings. Only the recorded members are
+// compared; the file system is never read.
+func Diff(a, b *Roster, ver Verify) (added []string, removed []string, changed []string) {
+	removed, added, changed = a.Diff(b, ver)
+	return added, removed, changed
+}
+
+// Diff compares the members of the receiver Roster ros with those of the given
+// Roster oth, and returns sorted lists of the files found only in ros, the files
+// found only in oth, and the files found in both whose Status differ per the
+// given Verify settings.
+func (ros *Roster) Diff(oth *Roster, ver Verify) (
+	only []string, othOnly []string, differ []string,
+) {
+	defer ros.lockPair(oth)()
+
+	mem, omem := ros.store(), oth.store()
+	only, othOnly, differ = []string{}, []string{}, []string{}
+	for _, s := range mem.Members() {
+		stat, _ := mem.Status(s)
+		if ostat, ok := omem.Status(s); !ok {
+			only = append(only, s)
+		} else if !stat.Equals(ostat, ver) {
+			differ = append(differ, s)
+		}
+	}
+	for _, s := range omem.Members() {
+		if _, ok := mem.Status(s); !ok {
+			othOnly = append(othOnly, s)
+		}
+	}
+	return only, othOnly, differ
+}
+
+// IncompleteMembers returns a sorted list of files in the receiver Roster ros
+// whose Status is missing one or more of the attributes enabled for
+// verification in the roster configuration.
+func (ros *Roster) IncompleteMembers() []string {
+	defer ros.lock()()
+	mem := ros.store()
+	inc := []string{}
+	for _, s := range mem.Members() {
+		if stat, _ := mem.Status(s); !stat.Complete(ros.Cfg.Ver) {
+			inc = append(inc, s)
+		}
+	}
+	return inc
+}
+
+// Moved pairs each of the given absent files with one of the given found files
+// having identical checksums, and returns the pairs as a mapping from absent
+// file path to found file path. Files are only paired if their checksums are
+// non-empty and unique among both the absent files and the found files.
+func (ros *Roster) Moved(absent []string, found []string) map[string]string {
+	defer ros.lock()()
+
+	// group each list of files by checksums, discarding duplicates
+	mem := ros.store()
+	group := func(list []string) map[string]string {
+		key := map[string]string{}
+		dup := map[string]bool{}
+		for _, s := range list {
+			stat, ok := mem.Status(s)
+			if !ok || len(stat.Check) == 0 {
+				continue
+			}
+			sums := make([]string, 0, len(stat.Check))
+			for _, sum := range stat.Check {
+				sums = append(sums, sum)
+			}
+			sort.Strings(sums)
+			k := strings.Join(sums, " ")
+			if _, ok := key[k]; ok {
+				dup[k] = true
+			}
+			key[k] = s
+		}
+		for k := range dup {
+			delete(key, k)
+		}
+		return key
+	}
+
+	abs, fnd := group(absent), group(found)
+	mov := map[string]string{}
+	for k, from := range abs {
+		if to, ok := fnd[k]; ok {
+			mov[from] = to
+		}
+	}
+	return mov
+}
+
 // Absentees returns a list of files that remain in the receiver Roster ros's
-// list of missing files.
+// list of missing files, sorted by path. Files ignored by git ignore patterns
+// added since the list was built (see Gitignore) are not included.
 func (ros *Roster) Absentees() []string {
-	abs := make([]string, len(ros.abs))
-	i := 0
-	for s := range ros.abs {
-		abs[i] = s
-		i++
+	var abs []string
+	unlock := ros.lock()
+	if nil != ros.db {
+		abs = ros.db.absentees()
+	} else {
+		abs = ros.mem.absentees()
+	}
+	unlock()
+	keep := abs[:0]
+	for _, s := range abs {
+		if !ros.Ignored(s) {
+			keep = append(keep, s)
+		}
 	}
-	return abs
+	return keep
 }
@@ -0,0 +1,85 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIncompleteMembers(t *testing.T) {
+	ros := New(false, filepath.Join(t.TempDir(), ".roster.yml"))
+	ros.Cfg.Ver = Verify{Fsize: true, Perms: true, Check: true}
+
+	sum := Checksums{HashXXHash: HashXXHash + HashSep + "0123456789abcdef"}
+	complete := Status{Fsize: 1, Perms: "-rw-r--r--", Mtime: StatusNoMtime, Check: sum, Owner: StatusNoOwner}
+	for filePath, stat := range map[string]Status{
+		"complete":  complete,
+		"dir":       {Fsize: 0, Perms: "drwxr-xr-x", Mtime: StatusNoMtime, Check: Checksums{}, Owner: StatusNoOwner},
+		"link":      {Fsize: 1, Perms: "Lrwxrwxrwx", Mtime: StatusNoMtime, Check: Checksums{}, Owner: StatusNoOwner, Link: "complete"},
+		"no-check":  {Fsize: 1, Perms: "-rw-r--r--", Mtime: StatusNoMtime, Check: Checksums{}, Owner: StatusNoOwner},
+		"no-perms":  {Fsize: 1, Perms: StatusNoPerms, Mtime: StatusNoMtime, Check: sum, Owner: StatusNoOwner},
+		"no-size":   {Fsize: StatusNoFsize, Perms: "-rw-r--r--", Mtime: StatusNoMtime, Check: sum, Owner: StatusNoOwner},
+		"sub/check": {Fsize: 1, Perms: "-rw-r--r--", Mtime: StatusNoMtime, Check: Checksums{}, Owner: StatusNoOwner},
+	} {
+		if err := ros.Update(filePath, stat); nil != err {
+			t.Fatalf("Update(%q): %v", filePath, err)
+		}
+	}
+
+	want := []string{"no-check", "no-perms", "no-size", "sub/check"}
+	if got := ros.IncompleteMembers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("IncompleteMembers() = %q, want %q", got, want)
+	}
+
+	// attributes not verified are not required
+	ros.Cfg.Ver = Verify{Fsize: true}
+	want = []string{"no-size"}
+	if got := ros.IncompleteMembers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("IncompleteMembers() = %q, want %q", got, want)
+	}
+}
+
+// TestChangedReadOnlySkipsHash verifies that a file whose size changed is not
+// hashed by a read-only roster, using a file that no longer exists and thus
+// cannot be hashed.
+func TestChangedReadOnlySkipsHash(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "f")
+	if err := os.WriteFile(path, []byte("original"), 0644); nil != err {
+		t.Fatal(err)
+	}
+	ros := New(false, filepath.Join(root, ".roster.yml"))
+	info, err := os.Lstat(path)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if _, _, stat, err := ros.Changed(root, "f", info); nil != err {
+		t.Fatalf("Changed(): %v", err)
+	} else if err := ros.Update("f", stat); nil != err {
+		t.Fatalf("Update(): %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("original and more"), 0644); nil != err {
+		t.Fatal(err)
+	}
+	if info, err = os.Lstat(path); nil != err {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path); nil != err {
+		t.Fatal(err)
+	}
+
+	// a roster that will be written records the checksums of a changed file
+	if _, _, _, err := ros.Changed(root, "f", info); nil == err {
+		t.Errorf("Changed(): hashed a file that does not exist")
+	}
+	ros.ReadOnly()
+	new, changed, stat, err := ros.Changed(root, "f", info)
+	if nil != err {
+		t.Fatalf("Changed(): read-only roster hashed a file whose size changed: %v", err)
+	}
+	if new || !changed || len(stat.Check) != 0 {
+		t.Errorf("Changed() = %t, %t, %d checksums, want false, true, 0", new, changed, len(stat.Check))
+	}
+}
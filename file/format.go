@@ -0,0 +1,149 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format identifies the encoding of a roster file on disk.
+type Format int
+
+// Constants defining the supported roster file formats.
+const (
+	FormatYAML Format = iota // default
+	FormatJSON
+	FormatGob
+	FormatSQLite
+)
+
+// Constants defining the file name extensions identifying roster files encoded
+// in JSON and gob format. All other roster files are encoded in YAML format.
+const (
+	FormatJSONExt = ".json"
+	FormatGobExt  = ".gob"
+)
+
+// FormatSQLiteExt is the file name extension identifying roster files stored in
+// an SQLite database, whose members are updated in place instead of rewriting
+// the entire roster file. Such roster files are never compressed, and they are
+// marshaled in YAML format (e.g., when previewed).
+const FormatSQLiteExt = ".db"
+
+// FormatGzipExt is the file name extension identifying roster files compressed
+// with gzip, following the extension identifying its Format (e.g., ".yml.gz").
+const FormatGzipExt = ".gz"
+
+// gzipMagic are the leading bytes of all gzip-compressed data.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// FormatOf returns the Format of the roster file at the given file path, based
+// on its file name extension, ignoring any FormatGzipExt extension.
+func FormatOf(filePath string) Format {
+	if strings.EqualFold(filepath.Ext(filePath), FormatSQLiteExt) {
+		return FormatSQLite
+	}
+	if Compressed(filePath) {
+		filePath = filePath[:len(filePath)-len(FormatGzipExt)]
+	}
+	switch ext := filepath.Ext(filePath); {
+	case strings.EqualFold(ext, FormatJSONExt):
+		return FormatJSON
+	case strings.EqualFold(ext, FormatGobExt):
+		return FormatGob
+	}
+	return FormatYAML
+}
+
+// String returns the name of the receiver Format f.
+func (f Format) String() string {
+	switch f {
+	case FormatJSON:
+		return "json"
+	case FormatGob:
+		return "gob"
+	case FormatSQLite:
+		return "sqlite"
+	default:
+		return "yaml"
+	}
+}
+
+// Marshal encodes the given value v using the receiver Format f.
+func (f Format) Marshal(v interface{}) ([]byte, error) {
+	switch f {
+	case FormatJSON:
+		data, err := json.MarshalIndent(v, "", "    ")
+		if nil != err {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case FormatGob:
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(v); nil != err {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return yaml.Marshal(v)
+	}
+}
+
+// Unmarshal decodes the given data into value v using the receiver Format f.
+func (f Format) Unmarshal(data []byte, v interface{}) error {
+	return f.Decode(bytes.NewReader(data), v)
+}
+
+// Decode decodes the content read from the given reader r into value v using
+// the receiver Format f, without first reading the entire content into memory.
+// Returns io.EOF if r has no content.
+func (f Format) Decode(r io.Reader, v interface{}) error {
+	switch f {
+	case FormatJSON:
+		return json.NewDecoder(r).Decode(v)
+	case FormatGob:
+		return gob.NewDecoder(r).Decode(v)
+	default:
+		return yaml.NewDecoder(r).Decode(v)
+	}
+}
+
+// Compressed returns whether or not the roster file at the given file path is
+// written with gzip compression, based on its file name extension.
+func Compressed(filePath string) bool {
+	return strings.EqualFold(filepath.Ext(filePath), FormatGzipExt)
+}
+
+// compress returns the given data compressed with gzip.
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); nil != err {
+		return nil, err
+	}
+	if err := zw.Close(); nil != err {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress returns a reader of the content read from the given reader r,
+// decompressed with gzip if it begins with the gzip magic bytes.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(gzipMagic))
+	if nil != err && io.EOF != err {
+		return nil, err
+	}
+	if !bytes.Equal(magic, gzipMagic) {
+		return br, nil
+	}
+	return gzip.NewReader(br)
+}
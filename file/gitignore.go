@@ -0,0 +1,260 @@
+package file
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// GitignoreFileName is the name of the file containing git ignore patterns.
+const GitignoreFileName = ".gitignore"
+
+// GitExcludePath is the path of the file containing the git ignore patterns of
+// a single repository, relative to the repository's root directory.
+var GitExcludePath = filepath.Join(".git", "info", "exclude")
+
+// FromGitignore reads the git ignore patterns from the file at given path and
+// translates them into an equivalent IgnoreRegexp. Patterns are translated
+// according to the gitignore format, including leading "/" to anchor a pattern
+// to the directory containing the file, trailing "/" to match only
+// directories, "**" to match any number of directories, and leading "!" to
+// negate a pattern.
+func FromGitignore(filePath string) (*IgnoreRegexp, error) {
+	return fromGitignore(filePath, "", GitignoreFileName)
+}
+
+// fromGitignore reads the git ignore patterns from the file at the given path
+// the same as FromGitignore, but translates them into patterns that only match
+// files beneath the given directory path, relative to the roster's directory
+// (or any file, if empty). Each pattern's Source identifies it by the given
+// name.
+func fromGitignore(filePath string, dir string, name string) (*IgnoreRegexp, error) {
+	f, err := os.Open(filePath)
+	if nil != err {
+		return nil, err
+	}
+	defer f.Close()
+
+	ire := IgnoreRegexp{}
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		line := scan.Text()
+		pat, neg, ok := gitignoreRegexp(line, dir)
+		if !ok {
+			continue
+		}
+		re, err := regexp.Compile(pat)
+		if nil != err {
+			return nil, err
+		}
+		ire = append(ire, IgnorePattern{Regexp: re, Negate: neg,
+			Source: strings.TrimSpace(line) + " (" + name + ")"})
+	}
+	if err := scan.Err(); nil != err {
+		return nil, err
+	}
+	return &ire, nil
+}
+
+// gitignoreRegexp translates a single line of a gitignore file into a regular
+// expression matching relative file paths beneath the given directory path (or
+// any file, if empty), and returns the expression, whether or not the pattern
+// is negated, and whether or not the line contains a pattern at all.
+func gitignoreRegexp(line string, dir string) (pat string, neg bool, ok bool) {
+	// trailing spaces are ignored unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", false, false
+	}
+	if strings.HasPrefix(line, "!") {
+		neg, line = true, line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+
+	if strings.TrimSuffix(line, "/") == "" {
+		return "", false, false
+	}
+	pat = globPattern(line)
+	if dir != "" {
+		// anchored patterns are anchored to the given directory instead, and
+		// all others may match at any depth beneath it
+		base := "^" + regexp.QuoteMeta(dir) + "/"
+		if strings.HasPrefix(pat, "(^|/)") {
+			pat = base + "(.*/)?" + strings.TrimPrefix(pat, "(^|/)")
+		} else {
+			pat = base + strings.TrimPrefix(pat, "^")
+		}
+	}
+	return pat, neg, true
+}
+
+// GlobalGitignore returns the path of the user's global git ignore file, which
+// is located in the git configuration directory, either $XDG_CONFIG_HOME/git or
+// $HOME/.config/git. Returns an empty string if neither is defined. A different
+// file configured with git setting core.excludesFile is not recognized.
+func GlobalGitignore() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "git", "ignore")
+	}
+	if home, err := os.UserHomeDir(); nil == err {
+		return filepath.Join(home, ".config", "git", "ignore")
+	}
+	return ""
+}
+
+// Gitignore adds the git ignore patterns in the .gitignore file (if any) of
+// the directory with the given path to the receiver Roster ros, so that they
+// apply to the files beneath that directory only, with the given path relative
+// to the roster's directory. Patterns added for a subdirectory take precedence
+// over those of its parent directories, the same as git, while the configured
+// ignore patterns take precedence over all git ignore patterns. The patterns of
+// each directory are only added once.
+// When adding the patterns of the roster's directory itself (i.e., relDir is
+// "."), the patterns of the user's global git ignore file (see GlobalGitignore)
+// and of the repository's exclude file (see GitExcludePath) are also added,
+// both with lower precedence than any .gitignore file.
+// This is used to evaluate git ignore patterns hierarchically as a directory
+// tree is walked (see Runtime.UseNestedGitignore).
+func (ros *Roster) Gitignore(dirPath string, relDir string) error {
+	relDir = filepath.ToSlash(filepath.Clean(relDir))
+	ros.gitlk.Lock()
+	defer ros.gitlk.Unlock()
+	if relDir == "." && !ros.gitExcl {
+		ros.gitExcl = true
+		var excl IgnoreRegexp
+		for _, f := range []struct{ path, name string }{
+			{GlobalGitignore(), "global " + GitignoreFileName},
+			{filepath.Join(dirPath, GitExcludePath), filepath.ToSlash(GitExcludePath)},
+		} {
+			if f.path == "" {
+				continue
+			}
+			ire, err := fromGitignore(f.path, "", f.name)
+			if nil != err && !os.IsNotExist(err) {
+				return err
+			}
+			if nil == err {
+				excl = append(excl, *ire...)
+			}
+		}
+		ros.git = append(excl, ros.git...)
+	}
+	if ros.gitDir[relDir] {
+		return nil
+	}
+	ros.gitDir[relDir] = true
+	dir, name := relDir, path.Join(relDir, GitignoreFileName)
+	if relDir == "." {
+		dir, name = "", GitignoreFileName
+	}
+	ire, err := fromGitignore(filepath.Join(dirPath, GitignoreFileName), dir, name)
+	if nil != err {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	ros.git = append(ros.git, *ire...)
+	return nil
+}
+
+// lastIgnore returns the last ignore pattern matching the given file path and
+// true, considering the git ignore patterns (see Gitignore) to precede the
+// configured ignore patterns, or false if no pattern matches. The configured
+// ignore patterns also match the absolute file path if Config.IgnoreAbsolute is
+// enabled, while git ignore patterns only ever match the relative file path.
+func (ros *Roster) lastIgnore(filePath string) (IgnorePattern, bool) {
+	abs := ""
+	if ros.Cfg.IgnoreAbsolute {
+		abs = ros.AbsPath(filePath)
+	}
+	for i := len(ros.Cfg.ire) - 1; i >= 0; i-- {
+		pat := ros.Cfg.ire[i]
+		if pat.MatchString(filePath) || ("" != abs && pat.MatchString(abs)) {
+			return pat, true
+		}
+	}
+	ros.gitlk.RLock()
+	defer ros.gitlk.RUnlock()
+	return ros.git.Last(filePath)
+}
+
+// globPattern translates the given glob pattern into a regular expression
+// matching relative file paths. A pattern containing a path separator is
+// anchored to the root directory, unless the only separator is a trailing one.
+// Otherwise, the pattern may match at any depth. A pattern with a trailing
+// separator matches only directories, i.e., paths containing files beneath it.
+// A pattern matching a directory also matches all paths beneath it.
+func globPattern(glob string) string {
+	suffix := "(/|$)"
+	if strings.HasSuffix(glob, "/") {
+		suffix, glob = "/", strings.TrimSuffix(glob, "/")
+	}
+	prefix := "(^|/)"
+	if strings.Contains(glob, "/") {
+		prefix, glob = "^", strings.TrimPrefix(glob, "/")
+	}
+	return prefix + globRegexp(glob) + suffix
+}
+
+// globRegexp translates the given glob pattern into an equivalent (unanchored)
+// regular expression. The wildcards "*" and "?" do not match path separators,
+// while "**" matches any number of path elements.
+func globRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch glob[i] {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					i++
+					b.WriteString("(.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			// find the end of the character class, which may begin with a
+			// literal ']' following the optional negation
+			j := i + 1
+			if j < len(glob) && (glob[j] == '!' || glob[j] == '^') {
+				j++
+			}
+			if j < len(glob) && glob[j] == ']' {
+				j++
+			}
+			for j < len(glob) && glob[j] != ']' {
+				j++
+			}
+			if j >= len(glob) {
+				b.WriteString("\\[")
+				break
+			}
+			class := glob[i+1 : j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, "\\", "\\\\") + "]")
+			i = j
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return b.String()
+}
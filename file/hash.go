@@ -0,0 +1,578 @@
+package file
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash"
+	"golang.org/x/crypto/blake2b"
+	"gopkg.in/yaml.v3"
+)
+
+// Constants identifying the supported checksum algorithms.
+const (
+	HashXXHash  = "xxhash"
+	HashCRC32   = "crc32"
+	HashMD5     = "md5"
+	HashSHA1    = "sha1"
+	HashSHA256  = "sha256"
+	HashSHA512  = "sha512"
+	HashBLAKE2b = "blake2b" // BLAKE2b-512, as computed by b2sum
+	HashDefault = HashXXHash
+)
+
+// HashSep separates the algorithm name from the digest in a Status checksum,
+// e.g., "sha256:abcd...".
+// HashHeadSep separates the digest from the number of leading bytes used to
+// compute a partial checksum, e.g., "sha256:abcd...~1024".
+// HashChunkSep separates the digest from the chunk size used to compute a
+// chunked checksum, e.g., "sha256:abcd...@1048576".
+const (
+	HashSep      = ":"
+	HashHeadSep  = "~"
+	HashChunkSep = "@"
+)
+
+// hashFunc maps each supported algorithm name to its hash constructor.
+var hashFunc = map[string]func() hash.Hash{
+	HashXXHash:  func() hash.Hash { return xxhash.New() },
+	HashCRC32:   func() hash.Hash { return crc32.NewIEEE() },
+	HashMD5:     md5.New,
+	HashSHA1:    sha1.New,
+	HashSHA256:  sha256.New,
+	HashSHA512:  sha512.New,
+	HashBLAKE2b: newBLAKE2b,
+}
+
+// newBLAKE2b returns a new unkeyed BLAKE2b-512 hash.
+func newBLAKE2b() hash.Hash {
+	h, _ := blake2b.New512(nil) // only returns an error if given an invalid key
+	return h
+}
+
+// HashAlgorithms returns a sorted list of the names of all supported checksum
+// algorithms.
+func HashAlgorithms() []string {
+	algo := make([]string, 0, len(hashFunc))
+	for s := range hashFunc {
+		algo = append(algo, s)
+	}
+	sort.Strings(algo)
+	return algo
+}
+
+// Hash stores the list of checksum algorithms computed for each indexed file.
+// It may be given in a roster file as either a single algorithm name or a list
+// of algorithm names.
+type Hash []string
+
+// Validate returns an error if any algorithm in the receiver Hash h is not
+// supported.
+func (h Hash) Validate() error {
+	for _, algo := range h {
+		if _, ok := hashFunc[algo]; !ok {
+			return UnsupportedHashError(algo)
+		}
+	}
+	return nil
+}
+
+// UnmarshalYAML decodes either a single algorithm name or a list of algorithm
+// names into the receiver Hash h.
+func (h *Hash) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*h = Hash{value.Value}
+		return nil
+	}
+	var algo []string
+	if err := value.Decode(&algo); nil != err {
+		return err
+	}
+	*h = Hash(algo)
+	return nil
+}
+
+// MarshalYAML encodes the receiver Hash h as a single algorithm name if it
+// contains exactly one algorithm, otherwise as a list of algorithm names.
+func (h Hash) MarshalYAML() (interface{}, error) {
+	if len(h) == 1 {
+		return h[0], nil
+	}
+	return []string(h), nil
+}
+
+// UnmarshalJSON decodes either a single algorithm name or a list of algorithm
+// names into the receiver Hash h.
+func (h *Hash) UnmarshalJSON(data []byte) error {
+	algo, err := unmarshalJSONStrings(data)
+	if nil != err {
+		return err
+	}
+	*h = Hash(algo)
+	return nil
+}
+
+// MarshalJSON encodes the receiver Hash h the same as MarshalYAML.
+func (h Hash) MarshalJSON() ([]byte, error) {
+	v, _ := h.MarshalYAML()
+	return json.Marshal(v)
+}
+
+// Checksums stores the checksums computed for a file, as a mapping from
+// algorithm name to the checksum string returned by Checksum.
+type Checksums map[string]string
+
+// Get returns the checksum computed with the given algorithm, or StatusNoCheck
+// if no such checksum exists.
+func (c Checksums) Get(algo string) string {
+	if sum, ok := c[algo]; ok {
+		return sum
+	}
+	return StatusNoCheck
+}
+
+// Equals compares the checksums computed with each algorithm present in both
+// the receiver Checksums c and d. Checksums computed over different content
+// (see Runtime.HashHead and Runtime.HashChunk), identified by their suffixes,
+// are never equal, e.g., those of a file hashed as a single chunk before it
+// grew beyond HashChunk bytes. Returns false if c and d have no algorithms in
+// common, unless both are empty.
+func (c Checksums) Equals(d Checksums) bool {
+	if len(c) == 0 || len(d) == 0 {
+		return len(c) == len(d)
+	}
+	common := false
+	for algo, sum := range c {
+		if dsum, ok := d[algo]; ok {
+			common = true
+			if sum != dsum {
+				return false
+			}
+		}
+	}
+	return common
+}
+
+// Comparable returns whether or not the checksums computed with each algorithm
+// present in both the receiver Checksums c and d were computed over the same
+// content (see Runtime.HashHead and Runtime.HashChunk), as identified by their
+// suffixes, so that Equals identifies whether or not the content differs.
+func (c Checksums) Comparable(d Checksums) bool {
+	for algo, sum := range c {
+		if dsum, ok := d[algo]; ok && checkSuffix(sum) != checkSuffix(dsum) {
+			return false
+		}
+	}
+	return true
+}
+
+// UnmarshalYAML decodes either a single checksum string or a list of checksum
+// strings into the receiver Checksums c. Checksum strings without an algorithm
+// prefix were recorded before multiple algorithms were supported, and are
+// therefore assumed to be xxhash checksums.
+func (c *Checksums) UnmarshalYAML(value *yaml.Node) error {
+	var sums []string
+	if value.Kind == yaml.ScalarNode {
+		sums = []string{value.Value}
+	} else if err := value.Decode(&sums); nil != err {
+		return err
+	}
+	c.decode(sums)
+	return nil
+}
+
+// decode stores each of the given checksum strings in the receiver Checksums c,
+// replacing any existing checksums.
+func (c *Checksums) decode(sums []string) {
+	*c = Checksums{}
+	for _, sum := range sums {
+		if sum == StatusNoCheck {
+			continue
+		}
+		if i := strings.Index(sum, HashSep); i >= 0 {
+			(*c)[sum[:i]] = sum
+		} else {
+			(*c)[HashXXHash] = HashXXHash + HashSep + sum
+		}
+	}
+}
+
+// MarshalYAML encodes the receiver Checksums c as a single checksum string if
+// it contains exactly one checksum, otherwise as a sorted list of checksum
+// strings.
+func (c Checksums) MarshalYAML() (interface{}, error) {
+	switch len(c) {
+	case 0:
+		return StatusNoCheck, nil
+	case 1:
+		for _, sum := range c {
+			return sum, nil
+		}
+	}
+	sums := make([]string, 0, len(c))
+	for _, sum := range c {
+		sums = append(sums, sum)
+	}
+	sort.Strings(sums)
+	return sums, nil
+}
+
+// UnmarshalJSON decodes either a single checksum string or a list of checksum
+// strings into the receiver Checksums c, the same as UnmarshalYAML.
+func (c *Checksums) UnmarshalJSON(data []byte) error {
+	sums, err := unmarshalJSONStrings(data)
+	if nil != err {
+		return err
+	}
+	c.decode(sums)
+	return nil
+}
+
+// MarshalJSON encodes the receiver Checksums c the same as MarshalYAML.
+func (c Checksums) MarshalJSON() ([]byte, error) {
+	v, _ := c.MarshalYAML()
+	return json.Marshal(v)
+}
+
+// unmarshalJSONStrings decodes either a single JSON string or a JSON array of
+// strings into a list of strings.
+func unmarshalJSONStrings(data []byte) ([]string, error) {
+	if string(bytes.TrimSpace(data)) == "null" {
+		return nil, nil
+	}
+	var one string
+	if err := json.Unmarshal(data, &one); nil == err {
+		return []string{one}, nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); nil != err {
+		return nil, err
+	}
+	return list, nil
+}
+
+// checkSuffix returns the portion of the given checksum following its hex-
+// encoded digest, which identifies the content length settings used to compute
+// it (e.g., "~1024" or "@1048576").
+func checkSuffix(check string) string {
+	i := strings.Index(check, HashSep) + len(HashSep)
+	for i < len(check) && strings.IndexByte("0123456789abcdef", check[i]) >= 0 {
+		i++
+	}
+	return check[i:]
+}
+
+// checkSuffixInt returns the integer following sep in the suffix of the given
+// checksum, or 0 if no such integer exists.
+func checkSuffixInt(check string, sep string) int {
+	suf := checkSuffix(check)
+	if i := strings.LastIndex(suf, sep); i >= 0 {
+		if n, err := strconv.Atoi(suf[i+len(sep):]); nil == err {
+			return n
+		}
+	}
+	return 0
+}
+
+// CheckHead returns the number of leading bytes used to compute the given
+// checksum, or RuntimeHashHeadNoLimit if it was computed over the entire file.
+func CheckHead(check string) int {
+	return checkSuffixInt(check, HashHeadSep)
+}
+
+// CheckChunk returns the chunk size used to compute the given checksum, or
+// RuntimeHashChunkNoLimit if it was computed as a single chunk.
+func CheckChunk(check string) int {
+	return checkSuffixInt(check, HashChunkSep)
+}
+
+// hashedAs returns the receiver Runtime rt with the HashHead and HashChunk
+// settings used to compute the given Checksums sums, as identified by their
+// suffixes, so that a file hashed with rt yields checksums comparable to sums.
+func (rt Runtime) hashedAs(sums Checksums) Runtime {
+	for _, sum := range sums {
+		rt.HashHead, rt.HashChunk = CheckHead(sum), CheckChunk(sum)
+		break
+	}
+	return rt
+}
+
+// Checksum computes the checksum of a file at given path using the given hash
+// algorithm. The returned string is the hex-encoded digest prefixed with the
+// algorithm name and HashSep.
+//
+// If rt.HashHead is positive, only the first HashHead bytes of the file along
+// with the file's size are hashed, and the returned string is suffixed with
+// HashHeadSep and HashHead.
+//
+// Otherwise, if rt.HashChunk is positive and the file is larger than HashChunk
+// bytes, the file is divided into consecutive chunks of HashChunk bytes (the
+// final chunk may be shorter), and each chunk is hashed concurrently. The
+// resulting digest is the hash of the concatenated binary digests of all
+// chunks, in order, computed with the same algorithm. The returned string is
+// suffixed with HashChunkSep and HashChunk.
+//
+// Otherwise, if rt.Mmap is positive and the file is at least Mmap bytes, the
+// file is hashed from memory if it can be mapped, with the same result.
+func Checksum(filePath string, algo string, rt Runtime) (sum string, err error) {
+	sums, err := MultiChecksum(filePath, rt, algo)
+	if nil != err {
+		return "", err
+	}
+	return sums[algo], nil
+}
+
+// MultiChecksum computes the checksum of a file at given path using each of
+// the given hash algorithms, reading the file only once. Each checksum is
+// formatted as described by Checksum.
+func MultiChecksum(filePath string, rt Runtime, algo ...string) (sums Checksums, err error) {
+	sums, _, err = multiChecksum(filePath, rt, nil, algo...)
+	return sums, err
+}
+
+// multiChecksum computes the checksums of a file the same as MultiChecksum, and
+// also writes the entire file to the given blockWriter, if not nil, while the
+// file is hashed. Returns the given blockWriter, or nil if the file was not
+// written to it (e.g., if only some of the file was hashed). If the file cannot
+// be hashed due to a transient error, it is hashed again up to rt.Retry times,
+// doubling the delay before each retry (see Runtime.Backoff).
+func multiChecksum(filePath string, rt Runtime, blk *blockWriter, algo ...string) (
+	Checksums, *blockWriter, error,
+) {
+	delay, err := rt.Backoff()
+	if nil != err {
+		delay = DefaultRetryDelay
+	}
+	for try := 0; ; try++ {
+		sums, b, err := hashFile(filePath, rt, blk, algo...)
+		if nil == err || try >= rt.Retry || !Transient(err) {
+			return sums, b, err
+		}
+		if nil != blk {
+			// the file may have been partially written before the error
+			blk.reset()
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// hashFile opens and hashes a file once, as described by multiChecksum.
+func hashFile(filePath string, rt Runtime, blk *blockWriter, algo ...string) (
+	sums Checksums, _ *blockWriter, err error,
+) {
+	f, err := os.Open(filePath)
+	if nil != err {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if nil != err {
+		return nil, nil, err
+	}
+
+	if rt.HashHead > RuntimeHashHeadNoLimit {
+		size := make([]byte, 8)
+		binary.BigEndian.PutUint64(size, uint64(info.Size()))
+
+		// hash only the leading bytes, followed by the file size
+		h, err := hashReader(
+			io.MultiReader(io.LimitReader(f, int64(rt.HashHead)), bytes.NewReader(size)), algo)
+		if nil != err {
+			return nil, nil, err
+		}
+		return formatSums(algo, h, HashHeadSep+strconv.Itoa(rt.HashHead)), nil, nil
+	}
+
+	if rt.HashChunk > RuntimeHashChunkNoLimit && info.Size() > int64(rt.HashChunk) {
+		h, err := hashChunks(f, info.Size(), int64(rt.HashChunk), algo)
+		if nil != err {
+			return nil, nil, err
+		}
+		return formatSums(algo, h, HashChunkSep+strconv.Itoa(rt.HashChunk)), nil, nil
+	}
+
+	if rt.Mmap > RuntimeMmapNever && info.Size() >= rt.Mmap {
+		if h, ok := hashMapped(f, info.Size(), algo, blk); ok {
+			return formatSums(algo, h, ""), blk, nil
+		}
+		if nil != blk {
+			// the file may have been partially written before mapping failed
+			blk.reset()
+		}
+	}
+
+	var r io.Reader = f
+	if nil != blk {
+		r = io.TeeReader(f, blk)
+	}
+	sums, err = MultiChecksumReader(r, algo...)
+	if nil != err {
+		return nil, nil, err
+	}
+	return sums, blk, nil
+}
+
+// ChecksumReader computes the checksum of all bytes read from the given reader
+// using the given hash algorithm. The returned string is the hex-encoded digest
+// prefixed with the algorithm name and HashSep.
+func ChecksumReader(r io.Reader, algo string) (sum string, err error) {
+	sums, err := MultiChecksumReader(r, algo)
+	if nil != err {
+		return "", err
+	}
+	return sums[algo], nil
+}
+
+// MultiChecksumReader computes the checksum of all bytes read from the given
+// reader using each of the given hash algorithms. Each checksum is formatted as
+// described by ChecksumReader.
+func MultiChecksumReader(r io.Reader, algo ...string) (sums Checksums, err error) {
+	h, err := hashReader(r, algo)
+	if nil != err {
+		return nil, err
+	}
+	return formatSums(algo, h, ""), nil
+}
+
+// newHashes returns a new hash for each of the given algorithms.
+func newHashes(algo []string) ([]hash.Hash, error) {
+	h := make([]hash.Hash, len(algo))
+	for i, a := range algo {
+		fn, ok := hashFunc[a]
+		if !ok {
+			return nil, UnsupportedHashError(a)
+		}
+		h[i] = fn()
+	}
+	return h, nil
+}
+
+// hashReader streams all bytes read from the given reader to a new hash for
+// each of the given algorithms, and returns the resulting hashes.
+func hashReader(r io.Reader, algo []string) ([]hash.Hash, error) {
+	h, err := newHashes(algo)
+	if nil != err {
+		return nil, err
+	}
+	w := make([]io.Writer, len(h))
+	for i := range h {
+		w[i] = h[i]
+	}
+
+	// use io.Copy to stream bytes in reader to all hashing functions
+	if _, err := io.Copy(io.MultiWriter(w...), r); nil != err {
+		return nil, err
+	}
+	return h, nil
+}
+
+// hashMapped maps the given file of the given size into memory and hashes it in
+// a single pass with each of the given algorithms, and returns the resulting
+// hashes and true. The file is also written to the given blockWriter, if not
+// nil. Returns false if the file cannot be mapped, or if its size changed while
+// mapped, in which case the file must be read instead.
+func hashMapped(f *os.File, size int64, algo []string, blk *blockWriter) (h []hash.Hash, ok bool) {
+	data, unmap, err := mmap(f, size)
+	if nil != err {
+		return nil, false
+	}
+	defer unmap()
+
+	// reading a page beyond the end of a file truncated while mapped raises a
+	// fault, which is recovered as a panic instead of terminating the program
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if nil != recover() {
+			h, ok = nil, false
+		}
+	}()
+
+	if h, err = newHashes(algo); nil != err {
+		return nil, false
+	}
+	for i := range h {
+		h[i].Write(data)
+	}
+	if nil != blk {
+		blk.Write(data)
+	}
+	if info, err := f.Stat(); nil != err || info.Size() != size {
+		return nil, false
+	}
+	return h, true
+}
+
+// hashChunks concurrently hashes each consecutive chunk of the given file with
+// each of the given algorithms, and returns for each algorithm the hash of the
+// concatenated binary digests of all chunks.
+func hashChunks(f *os.File, size int64, chunk int64, algo []string) ([]hash.Hash, error) {
+	num := int((size + chunk - 1) / chunk)
+	part := make([][]hash.Hash, num)
+	errs := make([]error, num)
+
+	// limit the number of chunks hashed simultaneously
+	sem := make(chan struct{}, runtime.NumCPU())
+	var wait sync.WaitGroup
+	for i := 0; i < num; i++ {
+		wait.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() { <-sem; wait.Done() }()
+			part[i], errs[i] = hashReader(
+				io.NewSectionReader(f, int64(i)*chunk, chunk), algo)
+		}(i)
+	}
+	wait.Wait()
+
+	for _, err := range errs {
+		if nil != err {
+			return nil, err
+		}
+	}
+
+	h, err := newHashes(algo)
+	if nil != err {
+		return nil, err
+	}
+	for i := range h {
+		for _, p := range part {
+			h[i].Write(p[i].Sum(nil))
+		}
+	}
+	return h, nil
+}
+
+// formatSums converts the given hashes to the checksum strings of their
+// respective algorithms, each suffixed with the given string.
+func formatSums(algo []string, h []hash.Hash, suffix string) Checksums {
+	sums := Checksums{}
+	for i, a := range algo {
+		if h64, ok := h[i].(hash.Hash64); ok {
+			// retain the unpadded format used by roster files predating the
+			// algorithm prefix
+			sums[a] = a + HashSep + strconv.FormatUint(h64.Sum64(), 16) + suffix
+		} else {
+			sums[a] = a + HashSep + hex.EncodeToString(h[i].Sum(nil)) + suffix
+		}
+	}
+	return sums
+}
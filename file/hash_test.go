@@ -0,0 +1,82 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChecksumsEquals(t *testing.T) {
+	const (
+		whole = HashXXHash + HashSep + "0123456789abcdef"
+		chunk = HashXXHash + HashSep + "0123456789abcdef" + HashChunkSep + "1024"
+		head  = HashXXHash + HashSep + "fedcba9876543210" + HashHeadSep + "1024"
+		other = HashSHA256 + HashSep + "00"
+	)
+	for _, tc := range []struct {
+		name string
+		c, d Checksums
+		want bool
+	}{
+		{"same", Checksums{HashXXHash: whole}, Checksums{HashXXHash: whole}, true},
+		{"empty", Checksums{}, Checksums{}, true},
+		{"one empty", Checksums{HashXXHash: whole}, Checksums{}, false},
+		{"no common algorithm", Checksums{HashXXHash: whole}, Checksums{HashSHA256: other}, false},
+		{"crossed chunk threshold", Checksums{HashXXHash: whole}, Checksums{HashXXHash: chunk}, false},
+		{"different head", Checksums{HashXXHash: chunk}, Checksums{HashXXHash: head}, false},
+	} {
+		if got := tc.c.Equals(tc.d); got != tc.want {
+			t.Errorf("%s: Equals() = %t, want %t", tc.name, got, tc.want)
+		}
+	}
+}
+
+// TestChangedHashHead verifies that changing the HashHead setting between two
+// scans does not report an unchanged file as modified, but still reports one
+// whose content changed, and that its checksums are then computed per the new
+// setting.
+func TestChangedHashHead(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "f")
+	if err := os.WriteFile(path, []byte("original content"), 0644); nil != err {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(path)
+	if nil != err {
+		t.Fatal(err)
+	}
+	ros := New(false, filepath.Join(root, ".roster.yml"))
+	ros.Cfg.Ver.Mtime = false
+	if _, _, stat, err := ros.Changed(root, "f", info); nil != err {
+		t.Fatalf("Changed(): %v", err)
+	} else if err := ros.Update("f", stat); nil != err {
+		t.Fatalf("Update(): %v", err)
+	}
+
+	ros.Cfg.Rt.HashHead = 4
+	_, changed, stat, err := ros.Changed(root, "f", info)
+	if nil != err {
+		t.Fatalf("Changed(): %v", err)
+	}
+	if changed {
+		t.Errorf("Changed(): unchanged file reported modified after HashHead changed")
+	}
+	for _, sum := range stat.Check {
+		if CheckHead(sum) != 4 {
+			t.Errorf("Changed(): checksum %q not computed with HashHead", sum)
+		}
+	}
+
+	// a change beyond the leading bytes is still detected
+	if err := os.WriteFile(path, []byte("original CONTENT"), 0644); nil != err {
+		t.Fatal(err)
+	}
+	if info, err = os.Lstat(path); nil != err {
+		t.Fatal(err)
+	}
+	if _, changed, _, err := ros.Changed(root, "f", info); nil != err {
+		t.Fatalf("Changed(): %v", err)
+	} else if !changed {
+		t.Errorf("Changed(): modified file not reported after HashHead changed")
+	}
+}
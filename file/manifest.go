@@ -0,0 +1,42 @@
+package file
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// ExportManifest writes a line to the given io.Writer for each member of the
+// receiver Roster ros having a checksum computed with the given algorithm, in
+// the same format as coreutils (e.g., sha256sum and b2sum): the hex-encoded
+// digest, two spaces, and the file path relative to the roster's directory.
+// Thus, the manifest may be verified with, e.g., "sha256sum -c" from within the
+// roster's directory. File paths containing a backslash or newline are escaped
+// the same as coreutils. Members whose checksum was computed from only part of
+// the file or in chunks (see CheckHead and CheckChunk) are omitted, since their
+// digest is not that of the file's content.
+func (ros *Roster) ExportManifest(w io.Writer, algo string) error {
+	if err := (Hash{algo}).Validate(); nil != err {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	for _, filePath := range ros.Members() {
+		stat, _ := ros.Status(filePath)
+		sum := stat.Check.Get(algo)
+		if StatusNoCheck == sum || "" != checkSuffix(sum) {
+			continue
+		}
+		digest := strings.TrimPrefix(sum, algo+HashSep)
+		if strings.ContainsAny(filePath, "\\\n") {
+			digest = "\\" + digest
+			filePath = manifestEscape.Replace(filePath)
+		}
+		if _, err := bw.WriteString(digest + "  " + filePath + "\n"); nil != err {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// manifestEscape escapes file paths in a manifest the same as coreutils.
+var manifestEscape = strings.NewReplacer("\\", "\\\\", "\n", "\\n")
@@ -0,0 +1,97 @@
+package file
+
+import (
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// testStatus returns a valid Status identified by the given size.
+func testStatus(size int64) Status {
+	stat := NoStatus()
+	stat.Fsize = size
+	stat.Perms = "-rw-r--r--"
+	return stat
+}
+
+func TestConcurrentUpdateStatus(t *testing.T) {
+	const (
+		workers = 16
+		files   = 500
+	)
+	ros := New(false, filepath.Join(t.TempDir(), ".roster.yml"))
+
+	path := func(w, i int) string {
+		return "d" + strconv.Itoa(w) + "/f" + strconv.Itoa(i)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(2)
+		// each writer updates its own files, then expels every other one
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < files; i++ {
+				if err := ros.Update(path(w, i), testStatus(int64(i))); nil != err {
+					t.Errorf("Update(%q): %v", path(w, i), err)
+					return
+				}
+			}
+			for i := 0; i < files; i += 2 {
+				ros.Expel(path(w, i))
+			}
+		}(w)
+		// each reader observes the files of another writer, which are either
+		// not yet members or have the Status written
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < files; i++ {
+				p := path((w+1)%workers, i)
+				if stat, ok := ros.Status(p); ok && stat.Fsize != int64(i) {
+					t.Errorf("Status(%q): size %d, want %d", p, stat.Fsize, i)
+				}
+			}
+			ros.Members()
+		}(w)
+	}
+	wg.Wait()
+
+	mem := ros.Members()
+	if want := workers * files / 2; len(mem) != want {
+		t.Fatalf("Members(): %d members, want %d", len(mem), want)
+	}
+	for w := 0; w < workers; w++ {
+		for i := 0; i < files; i++ {
+			stat, ok := ros.Status(path(w, i))
+			if ok != (i%2 == 1) {
+				t.Fatalf("Status(%q): member %t, want %t", path(w, i), ok, i%2 == 1)
+			}
+			if ok && stat.Fsize != int64(i) {
+				t.Fatalf("Status(%q): size %d, want %d", path(w, i), stat.Fsize, i)
+			}
+		}
+	}
+}
+
+// BenchmarkUpdateParallel measures the throughput of concurrent updates of
+// distinct files, which is limited by contention for the lock of each shard
+// (see memberShards).
+func BenchmarkUpdateParallel(b *testing.B) {
+	ros := New(false, filepath.Join(b.TempDir(), ".roster.yml"))
+	paths := make([]string, 1<<16)
+	for i := range paths {
+		paths[i] = "dir/file" + strconv.Itoa(i)
+	}
+	stat := testStatus(1)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			p := paths[i%len(paths)]
+			if err := ros.Update(p, stat); nil != err {
+				b.Fatal(err)
+			}
+			ros.Status(p)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package file
+
+import "time"
+
+// MergePolicy determines which Status is kept by Merge for a file that is a
+// member of both rosters with different Status.
+type MergePolicy int
+
+// Constants defining each MergePolicy.
+const (
+	MergeNewest  MergePolicy = iota // keep the Status with latest mtime (default)
+	MergeKeepDst                    // keep the Status of the destination roster
+	MergeKeepSrc                    // keep the Status of the source roster
+	MergeError                      // return a MergeConflictError, merging nothing
+)
+
+// Merge adds each member of the given source Roster src to the given destination
+// Roster dst, resolving members of both rosters with different Status using the
+// given MergePolicy. The configuration of dst is never modified, and src is
+// never modified at all. The destination roster must be written with Write for
+// the merged members to be written to disk.
+func Merge(dst *Roster, src *Roster, policy MergePolicy) error {
+	mem := src.Members()
+	// check for conflicts before merging anything
+	if MergeError == policy {
+		for _, filePath := range mem {
+			stat, _ := src.Status(filePath)
+			if prior, ok := dst.Status(filePath); ok && !prior.Equals(stat, AllVerify()) {
+				return MergeConflictError(filePath)
+			}
+		}
+	}
+	for _, filePath := range mem {
+		stat, _ := src.Status(filePath)
+		if prior, ok := dst.Status(filePath); ok && !prior.Equals(stat, AllVerify()) {
+			switch policy {
+			case MergeKeepDst:
+				continue
+			case MergeNewest:
+				if !mtime(stat).After(mtime(prior)) {
+					continue
+				}
+			}
+		}
+		if err := dst.Update(filePath, stat); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// mtime returns the last modification time recorded in the given Status, or the
+// zero time.Time if none is recorded.
+func mtime(stat Status) time.Time {
+	t, err := time.Parse(MtimeLayout, stat.Mtime)
+	if nil != err {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,15 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package file
+
+import (
+	"errors"
+	"os"
+)
+
+// mmap returns an error, as memory-mapped files are not supported on this
+// platform, so that files are always read instead.
+func mmap(f *os.File, size int64) ([]byte, func() error, error) {
+	return nil, nil, errors.New("memory-mapped files not supported")
+}
@@ -0,0 +1,12 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package file
+
+import "os"
+
+// owner returns StatusNoOwner, as file ownership is not supported on this
+// platform.
+func owner(info os.FileInfo) string {
+	return StatusNoOwner
+}
@@ -0,0 +1,20 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package file
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// owner returns the user and group IDs of the given file, formatted as
+// "uid:gid", or StatusNoOwner if they cannot be determined.
+func owner(info os.FileInfo) string {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return strconv.FormatUint(uint64(st.Uid), 10) + ":" +
+			strconv.FormatUint(uint64(st.Gid), 10)
+	}
+	return StatusNoOwner
+}
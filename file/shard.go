@@ -0,0 +1,241 @@
+package file
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// memberShards is the number of shards into which the members of a roster held
+// in memory are partitioned (see Roster.Update). With 32 workers updating
+// uniformly distributed paths, an update contends with another worker for the
+// same shard about 11% of the time with 256 shards, compared to 39% with 64,
+// while each shard costs only a mutex and three empty maps (see
+// BenchmarkUpdateParallel).
+const memberShards = 256
+
+// shard is a partition of the members of a roster held in memory, along with
+// the members of the partition not yet found during a walk and the prior Status
+// of members changed or removed, all guarded by its own lock.
+type shard struct {
+	lk  sync.Mutex
+	mem Member
+	abs Absent
+	pri Member
+}
+
+// shards is a Store of roster members held in memory, partitioned by a hash of
+// each file path, so that concurrent updates of different files rarely contend
+// for the same lock.
+type shards [memberShards]shard
+
+// newShards returns a new shards struct containing no members.
+func newShards() *shards {
+	s := &shards{}
+	for i := range s {
+		s[i].mem, s[i].abs, s[i].pri = Member{}, Absent{}, Member{}
+	}
+	return s
+}
+
+// of returns the shard containing the given file path, selected with the 32-bit
+// FNV-1a hash of the file path.
+func (s *shards) of(filePath string) *shard {
+	h := uint32(2166136261)
+	for i := 0; i < len(filePath); i++ {
+		h ^= uint32(filePath[i])
+		h *= 16777619
+	}
+	return &s[h%memberShards]
+}
+
+// Status returns the Status of the given file path and true, or the unique
+// NoStatus struct and false if it is not a member.
+func (s *shards) Status(filePath string) (Status, bool) {
+	sh := s.of(filePath)
+	sh.lk.Lock()
+	defer sh.lk.Unlock()
+	return sh.mem.Status(filePath)
+}
+
+// Update adds or replaces the Status of the given file path.
+func (s *shards) Update(filePath string, stat Status) error {
+	sh := s.of(filePath)
+	sh.lk.Lock()
+	defer sh.lk.Unlock()
+	return sh.mem.Update(filePath, stat)
+}
+
+// Expel removes the given file path, if it is a member.
+func (s *shards) Expel(filePath string) {
+	sh := s.of(filePath)
+	sh.lk.Lock()
+	defer sh.lk.Unlock()
+	sh.mem.Expel(filePath)
+}
+
+// Members returns a sorted list of all member file paths.
+func (s *shards) Members() []string {
+	mem := []string{}
+	s.each(func(sh *shard) {
+		for filePath := range sh.mem {
+			mem = append(mem, filePath)
+		}
+	})
+	sort.Strings(mem)
+	return mem
+}
+
+// each calls the given function with each shard in turn, holding its lock.
+func (s *shards) each(fn func(sh *shard)) {
+	for i := range s {
+		s[i].lk.Lock()
+		fn(&s[i])
+		s[i].lk.Unlock()
+	}
+}
+
+// update adds or replaces the Status of the given file path, the same as
+// Update, and also records its prior Status, if changed, and removes it from
+// the list of absent members, all while holding the lock of a single shard.
+func (s *shards) update(filePath string, stat Status) {
+	sh := s.of(filePath)
+	sh.lk.Lock()
+	defer sh.lk.Unlock()
+	if prior, ok := sh.mem[filePath]; ok && !prior.Equals(stat, AllVerify()) {
+		sh.pri[filePath] = prior
+	}
+	sh.mem[filePath] = stat
+	delete(sh.abs, filePath)
+}
+
+// expel removes the given file path, the same as Expel, and also records its
+// prior Status, if it is a member.
+func (s *shards) expel(filePath string) {
+	sh := s.of(filePath)
+	sh.lk.Lock()
+	defer sh.lk.Unlock()
+	if prior, ok := sh.mem[filePath]; ok {
+		sh.pri[filePath] = prior
+		delete(sh.mem, filePath)
+	}
+}
+
+// setPrior records the given Status as the prior Status of the given file path.
+func (s *shards) setPrior(filePath string, stat Status) {
+	sh := s.of(filePath)
+	sh.lk.Lock()
+	defer sh.lk.Unlock()
+	sh.pri[filePath] = stat
+}
+
+// prior returns the prior Status of the given file path and true, or the unique
+// NoStatus struct and false if none was recorded.
+func (s *shards) prior(filePath string) (Status, bool) {
+	sh := s.of(filePath)
+	sh.lk.Lock()
+	defer sh.lk.Unlock()
+	return sh.pri.Status(filePath)
+}
+
+// resetAbsent replaces the list of absent members with each member for which
+// the given function returns true.
+func (s *shards) resetAbsent(keep func(filePath string, stat Status) bool) {
+	s.each(func(sh *shard) {
+		sh.abs = Absent{}
+		for filePath, stat := range sh.mem {
+			if keep(filePath, stat) {
+				sh.abs[filePath] = true
+			}
+		}
+	})
+}
+
+// present removes the given file path from the list of absent members.
+func (s *shards) present(filePath string) {
+	sh := s.of(filePath)
+	sh.lk.Lock()
+	defer sh.lk.Unlock()
+	delete(sh.abs, filePath)
+}
+
+// presentDir removes each file path with the given prefix from the list of
+// absent members.
+func (s *shards) presentDir(prefix string) {
+	s.each(func(sh *shard) {
+		for filePath := range sh.abs {
+			if strings.HasPrefix(filePath, prefix) {
+				delete(sh.abs, filePath)
+			}
+		}
+	})
+}
+
+// absentees returns a sorted list of all absent members.
+func (s *shards) absentees() []string {
+	abs := []string{}
+	s.each(func(sh *shard) {
+		for filePath := range sh.abs {
+			abs = append(abs, filePath)
+		}
+	})
+	sort.Strings(abs)
+	return abs
+}
+
+// load adds each member of the given Member m, replacing any existing member
+// with the same file path, and removing the given prefix from each file path
+// that has it. A member with the prefix replaces one recorded without it.
+func (s *shards) load(m Member, prefix string) {
+	for filePath, stat := range m {
+		if "" == prefix || !strings.HasPrefix(filePath, prefix) {
+			s.Update(filePath, stat)
+		}
+	}
+	if "" != prefix {
+		for filePath, stat := range m {
+			if strings.HasPrefix(filePath, prefix) {
+				s.Update(strings.TrimPrefix(filePath, prefix), stat)
+			}
+		}
+	}
+}
+
+// member returns a copy of all members as a single Member mapping.
+func (s *shards) member() Member {
+	m := Member{}
+	s.each(func(sh *shard) {
+		for filePath, stat := range sh.mem {
+			m[filePath] = stat
+		}
+	})
+	return m
+}
+
+// clone returns a deep copy of all members, the list of absent members, and the
+// prior Status of each member, copying each shard while holding its lock.
+func (s *shards) clone() *shards {
+	c := newShards()
+	for i := range s {
+		s[i].lk.Lock()
+		for filePath, stat := range s[i].mem {
+			c[i].mem[filePath] = stat.clone()
+		}
+		for filePath := range s[i].abs {
+			c[i].abs[filePath] = true
+		}
+		for filePath, stat := range s[i].pri {
+			c[i].pri[filePath] = stat.clone()
+		}
+		s[i].lk.Unlock()
+	}
+	return c
+}
+
+// clear removes all members and the list of absent members. The prior Status
+// of each member is retained.
+func (s *shards) clear() {
+	s.each(func(sh *shard) {
+		sh.mem, sh.abs = Member{}, Absent{}
+	})
+}
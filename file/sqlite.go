@@ -0,0 +1,414 @@
+package file
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+)
+
+// SQLiteDriver is the name of the database/sql driver used to open roster files
+// with extension FormatSQLiteExt. The driver is only registered if built with
+// tag "sqlite"; otherwise, opening such a roster file returns an
+// UnsupportedFormatError.
+var SQLiteDriver = "sqlite3"
+
+// sqliteSchema creates the tables of a roster file stored in SQLite, which has
+// a single row containing the roster configuration, and a row per member, each
+// encoded in JSON.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS config (
+	id   INTEGER PRIMARY KEY CHECK (id = 0),
+	data TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS members (
+	path   TEXT PRIMARY KEY,
+	status TEXT NOT NULL
+);`
+
+// sqliteAbsent creates the table of members not yet found during a walk (see
+// Roster.ResetAbsent), which is temporary, so that it is never written to the
+// roster file and does not occupy memory.
+const sqliteAbsent = `
+CREATE TEMP TABLE IF NOT EXISTS absent (
+	path TEXT PRIMARY KEY
+);`
+
+// sqlitePrior creates the table of the prior Status of each member replaced or
+// removed (see Roster.Prior), which is temporary for the same reasons as the
+// table of absent members, so that it does not grow in memory with the number
+// of files changed.
+const sqlitePrior = `
+CREATE TEMP TABLE IF NOT EXISTS prior (
+	path   TEXT PRIMARY KEY,
+	status TEXT NOT NULL
+);`
+
+// sqliteTemp are the suffixes of the temporary files SQLite creates alongside a
+// database file, which are never indexed.
+var sqliteTemp = []string{"-journal", "-wal", "-shm"}
+
+// sqlStore is a Store of roster members in an SQLite database. All changes are
+// made in a single transaction, which is only committed by Roster.Write, so
+// that the database is updated in place without rewriting all members.
+type sqlStore struct {
+	db    *sql.DB
+	tx    *sql.Tx
+	get   *sql.Stmt
+	put   *sql.Stmt
+	del   *sql.Stmt
+	pres  *sql.Stmt
+	base  string // prefix of each member path as stored (see rebase)
+	err   error  // first error encountered by a method without an error result
+	errlk sync.Mutex
+}
+
+// openSQLite opens (or creates) the SQLite database at the given file path, and
+// begins a transaction.
+func openSQLite(filePath string) (*sqlStore, error) {
+	registered := false
+	for _, d := range sql.Drivers() {
+		registered = registered || d == SQLiteDriver
+	}
+	if !registered {
+		return nil, UnsupportedFormatError(FormatSQLite.String())
+	}
+	db, err := sql.Open(SQLiteDriver, filePath)
+	if nil != err {
+		return nil, err
+	}
+	// the temporary table only exists for the connection that created it
+	db.SetMaxOpenConns(1)
+	for _, schema := range []string{sqliteSchema, sqliteAbsent, sqlitePrior} {
+		if _, err := db.Exec(schema); nil != err {
+			db.Close()
+			return nil, err
+		}
+	}
+	s := &sqlStore{db: db}
+	if err := s.begin(); nil != err {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// begin begins a new transaction in which all changes are made.
+func (s *sqlStore) begin() error {
+	var err error
+	if s.tx, err = s.db.Begin(); nil != err {
+		return err
+	}
+	for _, st := range []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&s.get, "SELECT status FROM members WHERE path = ?"},
+		{&s.put, "INSERT OR REPLACE INTO members (path, status) VALUES (?, ?)"},
+		{&s.del, "DELETE FROM members WHERE path = ?"},
+		{&s.pres, "DELETE FROM absent WHERE path = ?"},
+	} {
+		if *st.stmt, err = s.tx.Prepare(st.query); nil != err {
+			s.tx.Rollback()
+			return err
+		}
+	}
+	return nil
+}
+
+// rebase sets the prefix of each member path as stored in the database, which
+// is omitted from each member path given to or returned by any method, and
+// prepends it to each member path stored without it (see Runtime.BasePath).
+func (s *sqlStore) rebase(base string) error {
+	s.base = base
+	if "" == base {
+		return nil
+	}
+	// a member stored with the prefix replaces one stored without it
+	if _, err := s.tx.Exec(
+		"UPDATE OR IGNORE members SET path = ?1 || path WHERE substr(path, 1, length(?1)) != ?1",
+		base); nil != err {
+		return err
+	}
+	_, err := s.tx.Exec(
+		"DELETE FROM members WHERE substr(path, 1, length(?1)) != ?1", base)
+	return err
+}
+
+// key returns the given member path as stored in the database.
+func (s *sqlStore) key(filePath string) string {
+	return s.base + filePath
+}
+
+// rel returns the given member path as stored in the database without the
+// prefix of each member path.
+func (s *sqlStore) rel(key string) string {
+	return strings.TrimPrefix(key, s.base)
+}
+
+// fail records the given error, if no error has been recorded already.
+func (s *sqlStore) fail(err error) {
+	s.errlk.Lock()
+	defer s.errlk.Unlock()
+	if nil == s.err {
+		s.err = err
+	}
+}
+
+// Status returns the Status of the given file path and true, or the unique
+// NoStatus struct and false if it is not a member.
+func (s *sqlStore) Status(filePath string) (Status, bool) {
+	var data []byte
+	err := s.get.QueryRow(s.key(filePath)).Scan(&data)
+	if sql.ErrNoRows == err {
+		return NoStatus(), false
+	}
+	var stat Status
+	if nil == err {
+		err = json.Unmarshal(data, &stat)
+	}
+	if nil != err {
+		s.fail(err)
+		return NoStatus(), false
+	}
+	return stat, true
+}
+
+// Update adds or replaces the Status of the given file path.
+func (s *sqlStore) Update(filePath string, stat Status) error {
+	data, err := json.Marshal(stat)
+	if nil != err {
+		return err
+	}
+	_, err = s.put.Exec(s.key(filePath), data)
+	return err
+}
+
+// Expel removes the given file path, if it is a member.
+func (s *sqlStore) Expel(filePath string) {
+	if _, err := s.del.Exec(s.key(filePath)); nil != err {
+		s.fail(err)
+	}
+}
+
+// Members returns a sorted list of all member file paths.
+func (s *sqlStore) Members() []string {
+	mem := []string{}
+	rows, err := s.tx.Query("SELECT path FROM members ORDER BY path")
+	if nil != err {
+		s.fail(err)
+		return mem
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var filePath string
+		if err := rows.Scan(&filePath); nil != err {
+			s.fail(err)
+			return mem
+		}
+		mem = append(mem, s.rel(filePath))
+	}
+	if err := rows.Err(); nil != err {
+		s.fail(err)
+	}
+	return mem
+}
+
+// resetAbsent replaces the list of absent members with each member for which
+// the given function returns true.
+func (s *sqlStore) resetAbsent(keep func(filePath string, stat Status) bool) {
+	if _, err := s.tx.Exec("DELETE FROM absent"); nil != err {
+		s.fail(err)
+		return
+	}
+	rows, err := s.tx.Query("SELECT path, status FROM members")
+	if nil != err {
+		s.fail(err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var filePath string
+		var data []byte
+		var stat Status
+		if err := rows.Scan(&filePath, &data); nil != err {
+			s.fail(err)
+			return
+		}
+		if err := json.Unmarshal(data, &stat); nil != err {
+			s.fail(err)
+			return
+		}
+		if keep(s.rel(filePath), stat) {
+			if _, err := s.tx.Exec("INSERT INTO absent (path) VALUES (?)", filePath); nil != err {
+				s.fail(err)
+				return
+			}
+		}
+	}
+	if err := rows.Err(); nil != err {
+		s.fail(err)
+	}
+}
+
+// absent adds the given file path to the list of absent members.
+func (s *sqlStore) absent(filePath string) {
+	if _, err := s.tx.Exec("INSERT OR IGNORE INTO absent (path) VALUES (?)", s.key(filePath)); nil != err {
+		s.fail(err)
+	}
+}
+
+// present removes the given file path from the list of absent members.
+func (s *sqlStore) present(filePath string) {
+	if _, err := s.pres.Exec(s.key(filePath)); nil != err {
+		s.fail(err)
+	}
+}
+
+// presentDir removes each file path with the given prefix from the list of
+// absent members.
+func (s *sqlStore) presentDir(prefix string) {
+	if _, err := s.tx.Exec(
+		"DELETE FROM absent WHERE substr(path, 1, length(?1)) = ?1", s.key(prefix)); nil != err {
+		s.fail(err)
+	}
+}
+
+// setPrior records the given Status as the prior Status of the given file path.
+func (s *sqlStore) setPrior(filePath string, stat Status) {
+	data, err := json.Marshal(stat)
+	if nil == err {
+		_, err = s.tx.Exec(
+			"INSERT OR REPLACE INTO prior (path, status) VALUES (?, ?)", s.key(filePath), data)
+	}
+	if nil != err {
+		s.fail(err)
+	}
+}
+
+// prior returns the prior Status of the given file path and true, or the unique
+// NoStatus struct and false if none was recorded.
+func (s *sqlStore) prior(filePath string) (Status, bool) {
+	var data []byte
+	err := s.tx.QueryRow("SELECT status FROM prior WHERE path = ?", s.key(filePath)).Scan(&data)
+	if sql.ErrNoRows == err {
+		return NoStatus(), false
+	}
+	var stat Status
+	if nil == err {
+		err = json.Unmarshal(data, &stat)
+	}
+	if nil != err {
+		s.fail(err)
+		return NoStatus(), false
+	}
+	return stat, true
+}
+
+// priors returns the prior Status of each file path recorded.
+func (s *sqlStore) priors() Member {
+	pri := Member{}
+	rows, err := s.tx.Query("SELECT path, status FROM prior")
+	if nil != err {
+		s.fail(err)
+		return pri
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var filePath string
+		var data []byte
+		var stat Status
+		if err := rows.Scan(&filePath, &data); nil != err {
+			s.fail(err)
+			return pri
+		}
+		if err := json.Unmarshal(data, &stat); nil != err {
+			s.fail(err)
+			return pri
+		}
+		pri[s.rel(filePath)] = stat
+	}
+	if err := rows.Err(); nil != err {
+		s.fail(err)
+	}
+	return pri
+}
+
+// absentees returns a sorted list of all absent members.
+func (s *sqlStore) absentees() []string {
+	abs := []string{}
+	rows, err := s.tx.Query("SELECT path FROM absent ORDER BY path")
+	if nil != err {
+		s.fail(err)
+		return abs
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var filePath string
+		if err := rows.Scan(&filePath); nil != err {
+			s.fail(err)
+			return abs
+		}
+		abs = append(abs, s.rel(filePath))
+	}
+	if err := rows.Err(); nil != err {
+		s.fail(err)
+	}
+	return abs
+}
+
+// config decodes the roster configuration stored in the database into the
+// given Config cfg, which is unmodified if no configuration is stored.
+func (s *sqlStore) config(cfg *Config) error {
+	var data []byte
+	err := s.tx.QueryRow("SELECT data FROM config WHERE id = 0").Scan(&data)
+	if sql.ErrNoRows == err {
+		return nil
+	} else if nil != err {
+		return err
+	}
+	return json.Unmarshal(data, cfg)
+}
+
+// commit stores the given roster configuration, commits all changes made since
+// the last commit, and sets the permissions of the database file.
+func (s *sqlStore) commit(cfg Config, perm os.FileMode, filePath string) error {
+	data, err := json.Marshal(cfg)
+	if nil != err {
+		return err
+	}
+	if _, err := s.tx.Exec(
+		"INSERT OR REPLACE INTO config (id, data) VALUES (0, ?)", data); nil != err {
+		return err
+	}
+	if err := s.flush(); nil != err {
+		return err
+	}
+	return os.Chmod(filePath, perm)
+}
+
+// flush commits all changes made since the last commit, without storing the
+// roster configuration, and begins a new transaction. Returns the first error
+// encountered by any method since the last commit, if any, without committing.
+func (s *sqlStore) flush() error {
+	s.errlk.Lock()
+	err := s.err
+	s.errlk.Unlock()
+	if nil != err {
+		return err
+	}
+	if err := s.tx.Commit(); nil != err {
+		return err
+	}
+	return s.begin()
+}
+
+// close discards all changes made since the last commit, and closes the
+// database.
+func (s *sqlStore) close() error {
+	if nil != s.tx {
+		s.tx.Rollback()
+	}
+	return s.db.Close()
+}
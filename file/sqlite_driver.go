@@ -0,0 +1,7 @@
+//go:build sqlite
+// +build sqlite
+
+package file
+
+// register the SQLite driver named by SQLiteDriver
+import _ "github.com/mattn/go-sqlite3"
@@ -0,0 +1,100 @@
+//go:build sqlite
+// +build sqlite
+
+package file
+
+import (
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// parseSQLite returns a roster stored in SQLite in a new temporary directory,
+// with the given number of members.
+func parseSQLite(t *testing.T, members int) *Roster {
+	t.Helper()
+	ros, err := Parse(filepath.Join(t.TempDir(), ".roster"+FormatSQLiteExt))
+	if nil != err {
+		t.Fatalf("Parse(): %v", err)
+	}
+	t.Cleanup(func() { ros.Close() })
+	for i := 0; i < members; i++ {
+		stat := Status{Fsize: int64(i), Perms: "-rw-r--r--", Mtime: StatusNoMtime,
+			Check: Checksums{}, Owner: StatusNoOwner}
+		if err := ros.Update("f"+strconv.Itoa(i), stat); nil != err {
+			t.Fatalf("Update(): %v", err)
+		}
+	}
+	return ros
+}
+
+// TestDiffSQLite verifies that a roster stored in SQLite may be diffed with
+// itself, and that two such rosters may be diffed with each other in opposite
+// order concurrently, without deadlock.
+func TestDiffSQLite(t *testing.T) {
+	a, b := parseSQLite(t, 10), parseSQLite(t, 20)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if only, othOnly, differ := a.Diff(a, DefaultVerify()); len(only)+len(othOnly)+len(differ) != 0 {
+			t.Errorf("Diff(self): %q, %q, %q, want none", only, othOnly, differ)
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(2)
+			go func() { defer wg.Done(); a.Diff(b, DefaultVerify()) }()
+			go func() { defer wg.Done(); b.Diff(a, DefaultVerify()) }()
+		}
+		wg.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("Diff(): deadlock")
+	}
+
+	if _, othOnly, _ := a.Diff(b, DefaultVerify()); len(othOnly) != 10 {
+		t.Errorf("Diff(): %d files only in other, want 10", len(othOnly))
+	}
+}
+
+// TestPriorSQLite verifies that neither the members of a roster stored in
+// SQLite nor the prior Status of those changed are held in memory, so that the
+// memory used by a walk does not grow with the number of files, and that the
+// prior Status is still returned by Prior.
+func TestPriorSQLite(t *testing.T) {
+	const members = 1000
+	ros := parseSQLite(t, members)
+	if err := ros.Write(); nil != err {
+		t.Fatalf("Write(): %v", err)
+	}
+	if nil == ros.db {
+		t.Fatal("Parse(): roster not stored in SQLite")
+	}
+	ros.Cfg.Rt.Flush = 100
+	for i := 0; i < members; i++ {
+		stat := Status{Fsize: int64(i + 1), Perms: "-rw-r--r--", Mtime: StatusNoMtime,
+			Check: Checksums{}, Owner: StatusNoOwner}
+		if err := ros.Update("f"+strconv.Itoa(i), stat); nil != err {
+			t.Fatalf("Update(): %v", err)
+		}
+	}
+	ros.Expel("f0")
+
+	held := 0
+	ros.mem.each(func(sh *shard) {
+		held += len(sh.mem) + len(sh.abs) + len(sh.pri)
+	})
+	if held != 0 {
+		t.Errorf("%d members, absentees, and prior Status held in memory, want 0", held)
+	}
+	// the prior Status of an expelled member is the one it was expelled with
+	for filePath, want := range map[string]int64{"f0": 1, "f1": 1, "f999": members - 1} {
+		if prior, ok := ros.Prior(filePath); !ok || prior.Fsize != want {
+			t.Errorf("Prior(%q) = %d, %t, want %d, true", filePath, prior.Fsize, ok, want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package file
+
+import (
+	"path"
+	"time"
+)
+
+// Stats contains aggregate attributes of all members of a roster, computed from
+// their recorded Status alone (see Roster.Stats).
+type Stats struct {
+	Members int            `json:"members"` // number of members, including directories
+	Dirs    int            `json:"dirs"`    // number of directories (see Runtime.IndexDirs)
+	Size    int64          `json:"size"`    // sum of the recorded size of each file
+	Ext     map[string]int `json:"ext"`     // number of files per file name extension
+	Oldest  time.Time      `json:"oldest"`  // earliest recorded last modification time
+	Newest  time.Time      `json:"newest"`  // latest recorded last modification time
+}
+
+// Stats returns the aggregate attributes of all members of the receiver Roster
+// ros, computed from their recorded Status without reading the file system.
+// Files without an extension are counted with extension "". The Oldest and
+// Newest times are zero if no member has a recorded last modification time.
+func (ros *Roster) Stats() Stats {
+	defer ros.lock()()
+	mem := ros.store()
+	st := Stats{Ext: map[string]int{}}
+	for _, filePath := range mem.Members() {
+		stat, _ := mem.Status(filePath)
+		st.Members++
+		if stat.IsDir() {
+			st.Dirs++
+			continue
+		}
+		if StatusNoFsize != stat.Fsize {
+			st.Size += stat.Fsize
+		}
+		st.Ext[path.Ext(path.Base(filePath))]++
+		if t, err := time.Parse(MtimeLayout, stat.Mtime); nil == err {
+			if st.Oldest.IsZero() || t.Before(st.Oldest) {
+				st.Oldest = t
+			}
+			if st.Newest.IsZero() || t.After(st.Newest) {
+				st.Newest = t
+			}
+		}
+	}
+	return st
+}
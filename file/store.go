@@ -0,0 +1,76 @@
+package file
+
+import "sort"
+
+// Store persists the Status of each member of a roster. Members of roster files
+// written in their entirety (e.g., YAML) are held in memory, partitioned into
+// shards, and roster files with extension FormatSQLiteExt are stored in an
+// SQLite database.
+type Store interface {
+	// Status returns the Status of the given file path and true, or the unique
+	// NoStatus struct and false if the file path is not a member.
+	Status(filePath string) (Status, bool)
+	// Update adds or replaces the Status of the given file path.
+	Update(filePath string, stat Status) error
+	// Expel removes the given file path, if it is a member.
+	Expel(filePath string)
+	// Members returns a sorted list of all member file paths.
+	Members() []string
+}
+
+// Status returns the Status of the given file path in the receiver Member m and
+// true, or the unique NoStatus struct and false if it is not a member.
+func (m Member) Status(filePath string) (Status, bool) {
+	if stat, ok := m[filePath]; ok {
+		return stat, true
+	}
+	return NoStatus(), false
+}
+
+// Update adds or replaces the Status of the given file path in the receiver
+// Member m.
+func (m Member) Update(filePath string, stat Status) error {
+	m[filePath] = stat
+	return nil
+}
+
+// Expel removes the given file path from the receiver Member m.
+func (m Member) Expel(filePath string) {
+	delete(m, filePath)
+}
+
+// Members returns a sorted list of all file paths in the receiver Member m.
+func (m Member) Members() []string {
+	mem := make([]string, 0, len(m))
+	for s := range m {
+		mem = append(mem, s)
+	}
+	sort.Strings(mem)
+	return mem
+}
+
+// store returns the Store of the receiver Roster ros's members.
+func (ros *Roster) store() Store {
+	if nil != ros.db {
+		return ros.db
+	}
+	return ros.mem
+}
+
+// Members returns a sorted list of all file paths in the receiver Roster ros's
+// index.
+func (ros *Roster) Members() []string {
+	defer ros.lock()()
+	return ros.store().Members()
+}
+
+// Close releases the resources held by the receiver Roster ros's Store, if any,
+// discarding all changes not yet written with Write.
+func (ros *Roster) Close() error {
+	if nil == ros.db {
+		return nil
+	}
+	err := ros.db.close()
+	ros.db = nil
+	return err
+}
@@ -1,9 +1,25 @@
 module github.com/ardnew/roster
 
-go 1.15
+go 1.18
 
 require (
 	github.com/ardnew/version v0.2.0
 	github.com/cespare/xxhash v1.1.0
+	github.com/fsnotify/fsnotify v1.4.9
+	github.com/mattn/go-sqlite3 v1.14.6
+	github.com/prometheus/client_golang v1.14.0
+	golang.org/x/crypto v0.11.0
 	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776
 )
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
+	github.com/prometheus/client_model v0.3.0 // indirect
+	github.com/prometheus/common v0.37.0 // indirect
+	github.com/prometheus/procfs v0.8.0 // indirect
+	golang.org/x/sys v0.10.0 // indirect
+	google.golang.org/protobuf v1.28.1 // indirect
+)
@@ -0,0 +1,68 @@
+package roster
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/ardnew/roster/file"
+)
+
+// Constants identifying each kind of Change reported by JSONTaker.
+const (
+	ChangeNew = "new"
+	ChangeMod = "mod"
+	ChangeDel = "del"
+	ChangeBad = "bad"
+	ChangeMov = "mov"
+	ChangeApp = "app"
+)
+
+// Change describes a single file reported by the handlers of JSONTaker. Field
+// Old is omitted for new files, and field New is omitted for deleted files.
+// Field Diff is only included for modified, appended, and corrupted files.
+type Change struct {
+	Change string       `json:"change"`         // kind of change (e.g., ChangeNew)
+	Path   string       `json:"path"`           // file path, or new path if moved
+	From   string       `json:"from,omitempty"` // original path if moved
+	Old    *file.Status `json:"old,omitempty"`  // previously recorded Status
+	New    *file.Status `json:"new,omitempty"`  // current Status
+	Diff   []string     `json:"diff,omitempty"` // attributes that differ (see file.Status.Diff)
+}
+
+// JSONTaker returns a Taker whose handlers write each file reported to the given
+// io.Writer as a Change encoded in JSON, one per line (i.e., NDJSON).
+func JSONTaker(w io.Writer) Taker {
+	enc := json.NewEncoder(w)
+	return changeTaker(func(c Change) error { return enc.Encode(c) })
+}
+
+// changeTaker returns a Taker whose handlers pass each file reported to the
+// given function as a Change.
+func changeTaker(emit func(Change) error) Taker {
+	change := func(kind string, old, new bool) StatusHandler {
+		return func(filePath string, o file.Status, n file.Status) error {
+			c := Change{Change: kind, Path: filePath}
+			if old {
+				c.Old = &o
+			}
+			if new {
+				c.New = &n
+			}
+			if old && new {
+				c.Diff = o.Diff(n, o.Recorded())
+			}
+			return emit(c)
+		}
+	}
+	return Taker{
+		MovedFile: func(oldPath, newPath string) error {
+			return emit(Change{Change: ChangeMov, Path: newPath, From: oldPath})
+		},
+		NewFileWithStatus: change(ChangeNew, false, true),
+		ModFileWithStatus: change(ChangeMod, true, true),
+		DelFileWithStatus: change(ChangeDel, true, false),
+		BadFileWithStatus: change(ChangeBad, true, true),
+
+		AppendedFileWithStatus: change(ChangeApp, true, true),
+	}
+}
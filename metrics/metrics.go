@@ -0,0 +1,97 @@
+// Package metrics implements a Prometheus collector of the statistics of each
+// scan, as reported by the roster.Summary returned from the scan.
+package metrics
+
+import (
+	"github.com/ardnew/roster"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Label names of the metrics exported by Collector.
+const (
+	LabelDir    = "dir"    // directory path scanned
+	LabelChange = "change" // kind of change (e.g., roster.ChangeNew)
+)
+
+// Collector is a prometheus.Collector of the statistics of each scan observed.
+// Each metric is labeled with the directory path scanned.
+type Collector struct {
+	scanned  *prometheus.CounterVec
+	hashed   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	changes  *prometheus.CounterVec
+}
+
+// New returns a new Collector whose metric names are prefixed with the given
+// namespace, if not empty. The Collector must be registered (e.g., with
+// prometheus.MustRegister) before its metrics are exported.
+func New(namespace string) *Collector {
+	return &Collector{
+		scanned: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "files_scanned_total",
+			Help:      "Number of files scanned.",
+		}, []string{LabelDir}),
+		hashed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "hashed_bytes_total",
+			Help:      "Number of file content bytes hashed.",
+		}, []string{LabelDir}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "scan_duration_seconds",
+			Help:      "Time elapsed scanning each directory.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{LabelDir}),
+		changes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "files_changed_total",
+			Help:      "Number of files reported, by kind of change.",
+		}, []string{LabelDir, LabelChange}),
+	}
+}
+
+// Observe records the statistics of the given roster.Summary, or of each
+// directory path in its breakdown if multiple paths were scanned.
+func (c *Collector) Observe(sum roster.Summary) {
+	if len(sum.Dirs) > 0 {
+		for _, dir := range sum.Dirs {
+			c.Observe(dir)
+		}
+		return
+	}
+	c.scanned.WithLabelValues(sum.Path).Add(float64(sum.Scanned))
+	c.hashed.WithLabelValues(sum.Path).Add(float64(sum.Hashed))
+	c.duration.WithLabelValues(sum.Path).Observe(sum.Elapsed.Seconds())
+	for _, n := range []struct {
+		change string
+		count  int
+	}{
+		{roster.ChangeNew, sum.New},
+		{roster.ChangeMod, sum.Mod},
+		{roster.ChangeDel, sum.Del},
+		{roster.ChangeBad, sum.Bad},
+		{roster.ChangeMov, sum.Mov},
+		{roster.ChangeApp, sum.App},
+	} {
+		c.changes.WithLabelValues(sum.Path, n.change).Add(float64(n.count))
+	}
+}
+
+// Describe sends the descriptors of all metrics of the receiver Collector c to
+// the given channel, implementing prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.scanned.Describe(ch)
+	c.hashed.Describe(ch)
+	c.duration.Describe(ch)
+	c.changes.Describe(ch)
+}
+
+// Collect sends all metrics of the receiver Collector c to the given channel,
+// implementing prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.scanned.Collect(ch)
+	c.hashed.Collect(ch)
+	c.duration.Collect(ch)
+	c.changes.Collect(ch)
+}
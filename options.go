@@ -0,0 +1,237 @@
+package roster
+
+import (
+	"context"
+	"io"
+
+	"github.com/ardnew/roster/file"
+)
+
+// DefaultFileName is the roster file name used by TakeWith unless the WithFile
+// option is given.
+const DefaultFileName = ".roster.yml"
+
+// options contains the settings used to take a roster, as configured by each
+// Option given to TakeWith.
+type options struct {
+	take      Taker
+	filename  string
+	update    bool
+	audit     bool
+	dirs      []string
+	threads   int                // if positive, overrides Runtime.Thr of each roster
+	depth     int                // if not negative, overrides Runtime.Dep of each roster
+	flush     int                // if positive, overrides Runtime.Flush of each roster
+	since     string             // if not empty, overrides Runtime.Since of each roster
+	minAge    string             // if not empty, overrides Runtime.MinAge of each roster
+	maxAge    string             // if not empty, overrides Runtime.MaxAge of each roster
+	gitignore bool               // if true, enables Runtime.UseNestedGitignore of each roster
+	oneFS     bool               // if true, enables Runtime.OneFilesystem of each roster
+	parallel  int                // number of directories walked concurrently, if greater than 1
+	prune     bool               // if true, only deleted files are identified (see walk.Prune)
+	parents   bool               // if true, roster files are searched for in parent directories
+	verify    func(*file.Verify) // if not nil, modifies Verify of each roster
+	hash      file.Hash          // if not empty, replaces Hash of each roster
+	compact   bool               // if true, enables Runtime.Compact of each roster
+	dryRun    bool               // if true, roster files are never written
+	preview   io.Writer          // if not nil, receives rosters that would be written
+	stdin     io.Reader          // if not nil, the roster is read from here (see WithStdio)
+	stdout    io.Writer          // if not nil, the roster is written here (see WithStdio)
+	webhook   string             // if not empty, URL notified of all files reported
+	ctx       context.Context    // if not nil, stops the scan once done (see Stream)
+	stream    bool               // if true, files are reported as soon as found (see Stream)
+}
+
+// Option configures the behavior of TakeWith.
+type Option func(*options)
+
+// WithFile sets the file name of the roster file in each directory.
+func WithFile(filename string) Option {
+	return func(o *options) { o.filename = filename }
+}
+
+// WithUpdate sets whether or not each roster file is written to disk with the
+// scan results.
+func WithUpdate(update bool) Option {
+	return func(o *options) { o.update = update }
+}
+
+// WithDirs appends the given directory paths to the list of directories walked.
+func WithDirs(dir ...string) Option {
+	return func(o *options) { o.dirs = append(o.dirs, dir...) }
+}
+
+// WithHandlers sets the Taker whose handlers are called for each file reported.
+func WithHandlers(take Taker) Option {
+	return func(o *options) { o.take = take }
+}
+
+// WithThreads overrides the number of threads configured in each roster file
+// (see file.Runtime) for this scan only, without modifying the roster file. The
+// configured number of threads is used if the given number is not positive.
+func WithThreads(threads int) Option {
+	return func(o *options) { o.threads = threads }
+}
+
+// WithDepth overrides the maximum recursion depth configured in each roster file
+// (see file.Runtime) for this scan only, without modifying the roster file. A
+// depth of file.RuntimeDepthNoLimit means unlimited recursion, and the
+// configured depth is used if the given depth is negative.
+func WithDepth(depth int) Option {
+	return func(o *options) { o.depth = depth }
+}
+
+// WithFlush overrides the number of updates after which members are committed
+// to each roster file stored in SQLite (see file.Runtime) for this scan only,
+// without modifying the roster file. The configured number is used if the
+// given number is not positive.
+func WithFlush(flush int) Option {
+	return func(o *options) { o.flush = flush }
+}
+
+// WithSince overrides the time before which files last modified are excluded
+// from each roster (see file.Runtime) for this scan only, without modifying the
+// roster file. The given time must be in RFC 3339 format, and the configured
+// time is used if it is empty.
+func WithSince(since string) Option {
+	return func(o *options) { o.since = since }
+}
+
+// WithAge overrides the minimum and maximum age of the files included in each
+// roster (see file.Runtime) for this scan only, without modifying the roster
+// file. Each age must be a duration accepted by time.ParseDuration (e.g.,
+// "720h"), and the configured age is used if the respective age is empty.
+func WithAge(min, max string) Option {
+	return func(o *options) { o.minAge, o.maxAge = min, max }
+}
+
+// WithNestedGitignore enables the git ignore patterns of every directory in
+// each roster's directory tree (see file.Runtime) for this scan only, without
+// modifying the roster file. The configured setting is used if the given value
+// is false.
+func WithNestedGitignore(enable bool) Option {
+	return func(o *options) { o.gitignore = enable }
+}
+
+// WithOneFilesystem enables Runtime.OneFilesystem of each roster (see
+// file.Runtime) for this scan only, so that directories on a different device
+// than each roster's directory are not traversed, without modifying the roster
+// file. The configured setting is used if the given value is false.
+func WithOneFilesystem(enable bool) Option {
+	return func(o *options) { o.oneFS = enable }
+}
+
+// WithParallel sets the maximum number of directories walked concurrently, each
+// with its own roster file. The handlers of the Taker given with WithHandlers
+// are never called concurrently, and all files of each directory are reported
+// together. Directories are walked one at a time if the given number is less
+// than 2.
+func WithParallel(parallel int) Option {
+	return func(o *options) { o.parallel = parallel }
+}
+
+// WithPrune sets whether or not only the deleted files are identified and
+// removed from each roster file, without hashing any file or identifying new,
+// modified, or moved files (see walk.Prune). This is much faster than a full
+// scan, and the Status of each existing member is left unchanged.
+func WithPrune(prune bool) Option {
+	return func(o *options) { o.prune = prune }
+}
+
+// WithSearchParents sets whether or not the roster file of each directory is
+// searched for in its parent directories if the directory does not contain one,
+// in which case the entire directory tree of the nearest roster file found is
+// walked instead, with all paths relative to the roster file's directory.
+func WithSearchParents(search bool) Option {
+	return func(o *options) { o.parents = search }
+}
+
+// WithVerify calls the given function with the Verify settings configured in
+// each roster file, which it may modify for this scan only, without modifying
+// the roster file.
+func WithVerify(set func(ver *file.Verify)) Option {
+	return func(o *options) { o.verify = set }
+}
+
+// WithHash replaces the checksum algorithms configured in each roster file (see
+// file.HashAlgorithms). Files whose recorded checksums were computed with other
+// algorithms are reported as modified, and if the roster files are updated,
+// they are written with the given algorithms.
+func WithHash(algo ...string) Option {
+	return func(o *options) { o.hash = file.Hash(algo) }
+}
+
+// WithCompact enables Runtime.Compact of each roster (see file.Runtime), so that
+// each member is written with only the attributes that are compared. Unlike
+// most other settings, it is written to the roster file, since the members it
+// omits are no longer recorded. The configured setting is used if the given
+// value is false.
+func WithCompact(enable bool) Option {
+	return func(o *options) { o.compact = enable }
+}
+
+// WithDryRun prevents each roster file from being written to disk, even if
+// WithUpdate is given. Instead, if WithUpdate is given and the given io.Writer
+// is not nil, the content each roster file would have been written with is
+// written to the given io.Writer, so that the effect of an update may be
+// previewed.
+func WithDryRun(w io.Writer) Option {
+	return func(o *options) { o.dryRun, o.preview = true, w }
+}
+
+// WithStdio reads the roster from the given io.Reader instead of the roster file
+// in the directory, and writes the roster to the given io.Writer instead of the
+// roster file, if WithUpdate is given. Exactly one directory must be given with
+// WithDirs. The roster file name is still used to determine the roster's Format
+// (see file.ParseReader).
+func WithStdio(r io.Reader, w io.Writer) Option {
+	return func(o *options) { o.stdin, o.stdout = r, w }
+}
+
+// WithWebhook posts a Notice of all files reported, encoded in JSON, to the
+// given URL once all directories have been walked, if any files were reported.
+// Failed posts are retried (see WebhookRetries).
+func WithWebhook(url string) Option {
+	return func(o *options) { o.webhook = url }
+}
+
+// TakeWith walks each directory path given by WithDirs the same as Take, using
+// the settings configured by the given options. By default, the roster file
+// name is DefaultFileName, the roster files are not updated, and the handlers
+// of DefaultTaker are called.
+func TakeWith(opts ...Option) (Summary, error) {
+	opt := options{
+		take:     DefaultTaker,
+		filename: DefaultFileName,
+		depth:    -1,
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+	return walkOrNotify(opt)
+}
+
+// AuditWith walks each directory path given by WithDirs the same as Audit, using
+// the settings configured by the given options. The roster files are never
+// modified, regardless of WithUpdate.
+func AuditWith(opts ...Option) (Summary, error) {
+	opt := options{
+		take:     DefaultTaker,
+		filename: DefaultFileName,
+		depth:    -1,
+	}
+	for _, o := range opts {
+		o(&opt)
+	}
+	opt.update, opt.audit = false, true
+	return walkOrNotify(opt)
+}
+
+// walkOrNotify walks each directory path with walkNotify if a webhook is given,
+// or else with walkAll.
+func walkOrNotify(opt options) (Summary, error) {
+	if opt.webhook != "" {
+		return walkNotify(opt)
+	}
+	return walkAll(opt)
+}
@@ -1,10 +1,17 @@
 package roster
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"log"
+	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/ardnew/roster/file"
 	"github.com/ardnew/roster/walk"
@@ -24,73 +31,901 @@ func init() {
 	}
 }
 
-type Handler func(string)
+// Handler is called with the path of each file reported. If it returns an
+// error, no more files are reported and the error is returned.
+type Handler func(string) error
 
+// MoveHandler is called with the original and new path of each moved file.
+type MoveHandler func(oldPath string, newPath string) error
+
+// StatusHandler is called with the path of a file along with its previously
+// recorded Status and its current Status. The previous Status of new files and
+// the current Status of deleted files are both file.NoStatus().
+type StatusHandler func(filePath string, old file.Status, new file.Status) error
+
+// Taker defines the handlers called for each file reported. Each WithStatus
+// handler, if not nil, is called along with its corresponding Handler. The
+// first error returned by any handler stops the scan, and the roster file is
+// not updated.
 type Taker struct {
-	NewFile Handler
-	ModFile Handler
-	DelFile Handler
+	NewFile      Handler
+	ModFile      Handler
+	DelFile      Handler
+	BadFile      Handler       // only used by Audit and Verify, in place of ModFile
+	MovedFile    MoveHandler   // if nil, moves are reported as new and deleted files
+	AppendedFile Handler       // if nil, appended files are reported as modified files
+	Progress     walk.Progress // called as each file is processed, if not nil
+	Skipped      walk.Skip     // called for each file excluded, if not nil
+	EnteredDir   walk.Enter    // called for each directory traversed, if not nil
+	SkippedDir   walk.Skip     // called for each directory not traversed, if not nil
+
+	NewFileWithStatus StatusHandler
+	ModFileWithStatus StatusHandler
+	DelFileWithStatus StatusHandler
+	BadFileWithStatus StatusHandler // only used by Audit and Verify, in place of ModFileWithStatus
+
+	AppendedFileWithStatus StatusHandler
+}
+
+// appends returns whether or not the receiver Taker take has a handler for
+// appended files, which are otherwise reported as modified files.
+func (take Taker) appends() bool {
+	return nil != take.AppendedFile || nil != take.AppendedFileWithStatus
+}
+
+// dirs returns the directory handlers of the receiver Taker take.
+func (take Taker) dirs() walk.Dirs {
+	return walk.Dirs{Enter: take.EnteredDir, Skip: take.SkippedDir}
 }
 
+// report calls the given Handler and StatusHandler, if not nil, for each of the
+// given file paths, obtaining each file's Status with the given function.
+// Returns the first error returned by either handler.
+func report(handler Handler, withStatus StatusHandler,
+	status func(string) (file.Status, file.Status), path []string) error {
+	for _, s := range path {
+		if handler != nil {
+			if err := handler(s); nil != err {
+				return err
+			}
+		}
+		if withStatus != nil {
+			old, new := status(s)
+			if err := withStatus(s, old, new); nil != err {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// statusOf returns a function returning the prior and current Status of a file
+// path in the given roster.
+func statusOf(ros *file.Roster) func(string) (file.Status, file.Status) {
+	return func(filePath string) (file.Status, file.Status) {
+		old, _ := ros.Prior(filePath)
+		new, _ := ros.Status(filePath)
+		return old, new
+	}
+}
+
+// Output is the destination of all messages written by the default handlers.
+var Output io.Writer = os.Stdout
+
 var (
-	DefaultNewHandler = Handler(func(filePath string) { fmt.Println("+ " + filePath) })
-	DefaultModHandler = Handler(func(filePath string) { fmt.Println(filePath) })
-	DefaultDelHandler = Handler(func(filePath string) { fmt.Println("- " + filePath) })
-	SkipHandler       = Handler(nil)
+	DefaultNewHandler = Handler(func(filePath string) error { return printLine("+ " + filePath) })
+	DefaultModHandler = Handler(func(filePath string) error { return printLine(filePath) })
+	DefaultDelHandler = Handler(func(filePath string) error { return printLine("- " + filePath) })
+	DefaultBadHandler = Handler(func(filePath string) error { return printLine("! " + filePath) })
+	DefaultAppHandler = Handler(func(filePath string) error { return printLine(">> " + filePath) })
+
+	DefaultModStatusHandler = StatusHandler(func(filePath string, old, new file.Status) error {
+		return printLine(filePath + changed(old, new))
+	})
+	DefaultBadStatusHandler = StatusHandler(func(filePath string, old, new file.Status) error {
+		return printLine("! " + filePath + changed(old, new))
+	})
+
+	DefaultMovHandler = MoveHandler(func(oldPath, newPath string) error {
+		return printLine("> " + oldPath + " -> " + newPath)
+	})
+	SkipHandler     = Handler(nil)
+	SkipMoveHandler = MoveHandler(nil)
 
 	DefaultTaker = Taker{
-		NewFile: DefaultNewHandler,
-		ModFile: DefaultModHandler,
-		DelFile: DefaultDelHandler,
+		NewFile:      DefaultNewHandler,
+		DelFile:      DefaultDelHandler,
+		MovedFile:    DefaultMovHandler,
+		AppendedFile: DefaultAppHandler,
+
+		ModFileWithStatus: DefaultModStatusHandler,
+		BadFileWithStatus: DefaultBadStatusHandler,
 	}
 	SkipTaker = Taker{
-		NewFile: SkipHandler,
-		ModFile: SkipHandler,
-		DelFile: SkipHandler,
+		NewFile:   SkipHandler,
+		ModFile:   SkipHandler,
+		DelFile:   SkipHandler,
+		BadFile:   SkipHandler,
+		MovedFile: SkipMoveHandler,
 	}
 )
 
-func Take(take Taker, filename string, update bool, path ...string) error {
+// changed returns the names of the attributes that differ between the given
+// prior and current Status of a file (see file.Status.Diff), separated by
+// commas and enclosed in brackets following a space, or an empty string if no
+// attributes differ. Attributes not recorded in the prior Status are omitted.
+func changed(old, new file.Status) string {
+	diff := old.Diff(new, old.Recorded())
+	if len(diff) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(diff, ",") + "]"
+}
+
+// printLine writes the given string followed by a newline to Output, discarding
+// the number of bytes written.
+func printLine(s string) error {
+	_, err := fmt.Fprintln(Output, s)
+	return err
+}
+
+// WriterTaker returns a Taker whose handlers write the same messages as those
+// of DefaultTaker, but to the given io.Writer instead of Output.
+func WriterTaker(w io.Writer) Taker {
+	return formatTaker(func(s string) error {
+		_, err := fmt.Fprintln(w, s)
+		return err
+	})
+}
 
+// LoggerTaker returns a Taker whose handlers write the same messages as those
+// of DefaultTaker, but to the given log.Logger instead of Output.
+func LoggerTaker(l *log.Logger) Taker {
+	return formatTaker(func(s string) error {
+		return l.Output(2, s)
+	})
+}
+
+// formatTaker returns a Taker whose handlers format the same messages as those
+// of DefaultTaker, and pass them to the given function.
+func formatTaker(out func(string) error) Taker {
+	return Taker{
+		NewFile: func(filePath string) error { return out("+ " + filePath) },
+		DelFile: func(filePath string) error { return out("- " + filePath) },
+		MovedFile: func(oldPath, newPath string) error {
+			return out("> " + oldPath + " -> " + newPath)
+		},
+		AppendedFile: func(filePath string) error { return out(">> " + filePath) },
+		ModFileWithStatus: func(filePath string, old, new file.Status) error {
+			return out(filePath + changed(old, new))
+		},
+		BadFileWithStatus: func(filePath string, old, new file.Status) error {
+			return out("! " + filePath + changed(old, new))
+		},
+	}
+}
+
+// Summary tallies the files reported to a Taker's handlers, along with the
+// number of file content bytes hashed and the time elapsed.
+type Summary struct {
+	Path    string        `json:"path,omitempty"` // directory path, or empty if multiple paths were walked
+	New     int           `json:"new"`            // number of files passed to NewFile
+	Mod     int           `json:"mod"`            // number of files passed to ModFile
+	Del     int           `json:"del"`            // number of files passed to DelFile
+	Bad     int           `json:"bad"`            // number of files passed to BadFile
+	Mov     int           `json:"mov"`            // number of files passed to MovedFile
+	App     int           `json:"app"`            // number of files passed to AppendedFile
+	Scanned int           `json:"scanned"`        // number of files scanned
+	Hashed  int64         `json:"hashed"`         // number of file content bytes hashed
+	Elapsed time.Duration `json:"elapsed"`        // time elapsed (nanoseconds, in JSON)
+	Dirs    []Summary     `json:"dirs,omitempty"` // breakdown per directory path, if multiple paths
+}
+
+// Changed returns whether or not any files were reported in the receiver
+// Summary sum.
+func (sum Summary) Changed() bool {
+	return sum.New+sum.Mod+sum.Del+sum.Bad+sum.Mov+sum.App > 0
+}
+
+// add adds the tallies of the given Summary oth to the receiver Summary sum.
+func (sum *Summary) add(oth Summary) {
+	sum.New += oth.New
+	sum.Mod += oth.Mod
+	sum.Del += oth.Del
+	sum.Bad += oth.Bad
+	sum.Mov += oth.Mov
+	sum.App += oth.App
+	sum.Scanned += oth.Scanned
+	sum.Hashed += oth.Hashed
+}
+
+// Take walks each of the given directory paths, passing all new, modified, and
+// deleted files to the respective handlers of the given Taker, and writes the
+// updated roster file to disk if update is true. Modified files whose content
+// was only appended to are passed to the AppendedFile handlers instead, if
+// either is not nil (see file.Runtime.HashBlock). Returns a Summary of all files
+// reported, with a breakdown per directory path if multiple paths are given.
+// Errors encountered with individual files do not stop the walk. Instead, they
+// are all returned together as walk.Errors once all paths have been walked.
+func Take(take Taker, filename string, update bool, path ...string) (Summary, error) {
+	return walkAll(options{
+		take: take, filename: filename, update: update, dirs: path, depth: -1,
+	})
+}
+
+// Audit walks each of the given directory paths and verifies every file
+// recorded in the roster index still matches its recorded Status. Files whose
+// recorded Status is valid but no longer matches are passed to the BadFile
+// handler instead of ModFile, which is never called. New and missing files are
+// still passed to the NewFile and DelFile handlers, respectively. The roster
+// files are never modified. Returns a Summary the same as Take.
+func Audit(take Taker, filename string, path ...string) (Summary, error) {
+	return walkAll(options{
+		take: take, filename: filename, audit: true, dirs: path, depth: -1,
+	})
+}
+
+// progress returns a walk.Progress that records the number of files scanned and
+// bytes hashed in the given Summary sum before calling the given walk.Progress,
+// if not nil.
+func progress(sum *Summary, prog walk.Progress) walk.Progress {
+	return func(scanned, total int, hashed int64, path string) {
+		sum.Scanned, sum.Hashed = scanned, hashed
+		if prog != nil {
+			prog(scanned, total, hashed, path)
+		}
+	}
+}
+
+// walkAll walks each directory path given in the options, the same as Take.
+// Up to opt.parallel directories are walked concurrently, if greater than one,
+// but the handlers of the Taker are never called concurrently, and all files of
+// each directory are reported together.
+func walkAll(opt options) (Summary, error) {
+
+	path := opt.dirs
+
+	var all Summary
 	if len(path) == 0 {
-		return errors.New("no directory path(s) provided")
+		return all, errors.New("no directory path(s) provided")
+	}
+	if nil != opt.stdin && len(path) != 1 {
+		return all, errors.New("exactly 1 directory path required with roster from input")
+	}
+	if opt.parents {
+		path = searchParents(opt.filename, path...)
+	}
+	if len(opt.hash) > 0 {
+		if err := opt.hash.Validate(); nil != err {
+			return all, err
+		}
+	}
+	cutoff := file.Runtime{Since: opt.since, MinAge: opt.minAge, MaxAge: opt.maxAge}
+	if _, err := cutoff.SinceTime(); nil != err {
+		return all, err
+	}
+	if _, _, err := cutoff.Ages(); nil != err {
+		return all, err
 	}
 
-	for _, dir := range path {
-		path := filepath.Join(dir, filename)
-		ros, err := file.Parse(path)
-		if nil != err {
-			return fmt.Errorf("file.Parse(): %s\n", err.Error())
+	start := time.Now()
+
+	limit := opt.parallel
+	if limit < 1 {
+		limit = 1
+	}
+	var takelk sync.Mutex
+	if limit > 1 {
+		opt.take = serialize(opt.take, &takelk)
+	}
+
+	// the results of each directory are kept in the order given
+	sums := make([]Summary, len(path))
+	errs := make([]error, len(path))
+	done := make([]bool, len(path))
+	var fail error
+	var faillk sync.Mutex
+	failed := func() bool {
+		faillk.Lock()
+		defer faillk.Unlock()
+		return nil != fail
+	}
+
+	sem := make(chan struct{}, limit)
+	var work sync.WaitGroup
+	for i, dir := range path {
+		sem <- struct{}{}
+		// no more directories are walked once an error stops the scan
+		if failed() {
+			<-sem
+			break
 		}
+		work.Add(1)
+		go func(i int, dir string) {
+			defer func() { <-sem; work.Done() }()
+			began := time.Now()
+			sum, err := walkDir(opt, dir, &takelk, failed)
+			sum.Elapsed = time.Since(began)
+			sums[i], errs[i] = sum, err
+			_, ok := err.(walk.Errors)
+			done[i] = nil == err || ok
+			if !done[i] && errStopped != err {
+				faillk.Lock()
+				if nil == fail {
+					fail = err
+				}
+				faillk.Unlock()
+			}
+		}(i, dir)
+	}
+	work.Wait()
 
-		new, mod, del := walk.Walk(dir, ros)
+	// the directories walked before an error stopped the scan are still
+	// tallied
+	var werrs walk.Errors
+	for i := range path {
+		if !done[i] {
+			continue
+		}
+		if werr, ok := errs[i].(walk.Errors); ok {
+			werrs = append(werrs, werr...)
+		}
+		all.add(sums[i])
+		all.Dirs = append(all.Dirs, sums[i])
+	}
+	if nil != fail {
+		return all, fail
+	}
+	all.Elapsed = time.Since(start)
+	if len(path) == 1 {
+		all = all.Dirs[0]
+	}
+	if len(werrs) > 0 {
+		return all, werrs
+	}
+	return all, nil
+}
+
+// walkDir walks the given directory path, reports all files to the handlers of
+// the Taker given in the options while holding the given lock, and updates the
+// directory's roster file, if enabled. The files are not reported, nor is the
+// roster file updated, if the given function returns true, indicating another
+// directory's scan was stopped by an error. Returns the Summary of all files
+// reported and any error encountered, which is of type walk.Errors if it did
+// not stop the scan.
+func walkDir(opt options, dir string, takelk *sync.Mutex, failed func() bool) (Summary, error) {
 
-		sort.Strings(new)
-		if take.NewFile != nil {
-			for _, s := range new {
-				take.NewFile(s)
+	take := opt.take
+	sum := Summary{Path: dir}
+
+	// a missing directory is reported by file.Parse
+	if stat, err := os.Stat(dir); nil == err && !stat.IsDir() {
+		return sum, file.InvalidPathError(dir)
+	}
+
+	path := filepath.Join(dir, opt.filename)
+	var ros *file.Roster
+	var err error
+	if nil != opt.stdin {
+		if ros, err = file.ParseReader(opt.stdin, path); nil != err {
+			return sum, fmt.Errorf("file.ParseReader(): %s\n", err.Error())
+		}
+	} else if ros, err = file.Parse(path); nil != err {
+		return sum, fmt.Errorf("file.Parse(): %s\n", err.Error())
+	}
+	defer ros.Close()
+
+	// override the number of threads, maximum depth, flush interval, git
+	// ignore patterns, modification time cutoff, and verified attributes
+	// without writing them to the roster file
+	rt, ver := ros.Cfg.Rt, ros.Cfg.Ver
+	if opt.verify != nil {
+		opt.verify(&ros.Cfg.Ver)
+	}
+	// the checksum algorithms are written to the roster file, since they
+	// must agree with the checksums recorded
+	if len(opt.hash) > 0 {
+		ros.Cfg.Hash = opt.hash
+	}
+	if opt.threads > 0 {
+		ros.Cfg.Rt.Thr = opt.threads
+	}
+	if opt.flush > 0 {
+		ros.Cfg.Rt.Flush = opt.flush
+	}
+	if opt.gitignore {
+		ros.Cfg.Rt.UseNestedGitignore = true
+	}
+	if opt.oneFS {
+		ros.Cfg.Rt.OneFilesystem = true
+	}
+	if opt.since != "" {
+		ros.Cfg.Rt.Since = opt.since
+	}
+	if opt.minAge != "" {
+		ros.Cfg.Rt.MinAge = opt.minAge
+	}
+	if opt.maxAge != "" {
+		ros.Cfg.Rt.MaxAge = opt.maxAge
+	}
+	if opt.depth >= 0 && opt.depth != ros.Cfg.Rt.Dep {
+		ros.Cfg.Rt.Dep = opt.depth
+		ros.ResetAbsent()
+	}
+	if !opt.update {
+		ros.ReadOnly()
+	}
+
+	ctx := opt.ctx
+	if nil == ctx {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// files reported while walking, which are not reported again afterward
+	reported := map[string]bool{}
+	var ferr error
+	var found walk.Found
+	if opt.stream {
+		status := statusOf(ros)
+		found = func(filePath string, new bool, appended bool) {
+			// a new file may be identified as moved once the walk finishes
+			if new && nil != take.MovedFile && ros.Cfg.Ver.Check {
+				return
+			}
+			handler, withStatus := take.ModFile, take.ModFileWithStatus
+			if new {
+				handler, withStatus = take.NewFile, take.NewFileWithStatus
+			} else if opt.audit {
+				handler, withStatus = take.BadFile, take.BadFileWithStatus
+			} else if appended && take.appends() {
+				handler, withStatus = take.AppendedFile, take.AppendedFileWithStatus
 			}
+			takelk.Lock()
+			defer takelk.Unlock()
+			if nil != ferr || failed() {
+				return
+			}
+			// an error from the handler stops the walk
+			if err := report(handler, withStatus, status, []string{filePath}); nil != err {
+				ferr = err
+				cancel()
+				return
+			}
+			reported[filePath] = true
+		}
+	}
+	unreported := func(path []string) []string {
+		if len(reported) == 0 {
+			return path
 		}
+		rem := []string{}
+		for _, s := range path {
+			if !reported[s] {
+				rem = append(rem, s)
+			}
+		}
+		return rem
+	}
+
+	new, mod, app, del, mov := []string{}, []string{}, []string{}, []string{}, []walk.Move{}
+	if opt.prune {
+		del, err = walk.Prune(dir, ros, progress(&sum, take.Progress), take.Skipped, take.dirs())
+	} else {
+		new, mod, app, del, mov, err = walk.WalkContext(ctx, dir, ros,
+			progress(&sum, take.Progress), take.Skipped, take.dirs(), found)
+	}
+	ros.Cfg.Rt, ros.Cfg.Ver = rt, ver
+	// members are written compactly per the Verify settings written with them
+	if opt.compact {
+		ros.Cfg.Rt.Compact = true
+	}
+	werr, ok := err.(walk.Errors)
+
+	takelk.Lock()
+	defer takelk.Unlock()
+	if failed() {
+		return sum, errStopped
+	}
+	// the walk was stopped by an error from a handler, or by the context
+	if nil != ferr {
+		return sum, ferr
+	}
+	if nil != err && !ok {
+		return sum, err
+	}
 
-		sort.Strings(mod)
-		if take.ModFile != nil {
-			for _, s := range mod {
-				take.ModFile(s)
+	if take.MovedFile != nil {
+		sum.Mov = len(mov)
+		for _, m := range mov {
+			if err := take.MovedFile(m.From, m.To); nil != err {
+				return sum, err
 			}
 		}
+	} else {
+		for _, m := range mov {
+			new = append(new, m.To)
+			del = append(del, m.From)
+		}
+	}
+
+	if !take.appends() || opt.audit {
+		mod = append(mod, app...)
+		app = []string{}
+	}
 
-		sort.Strings(del)
-		if take.DelFile != nil {
-			for _, s := range del {
-				take.DelFile(s)
+	status := statusOf(ros)
+
+	sort.Strings(new)
+	sum.New = len(new)
+	if err := report(take.NewFile, take.NewFileWithStatus, status, unreported(new)); nil != err {
+		return sum, err
+	}
+
+	sort.Strings(mod)
+	modFile, modFileWithStatus := take.ModFile, take.ModFileWithStatus
+	if opt.audit {
+		sum.Bad = len(mod)
+		modFile, modFileWithStatus = take.BadFile, take.BadFileWithStatus
+	} else {
+		sum.Mod = len(mod)
+	}
+	if err := report(modFile, modFileWithStatus, status, unreported(mod)); nil != err {
+		return sum, err
+	}
+
+	sort.Strings(app)
+	sum.App = len(app)
+	if err := report(take.AppendedFile, take.AppendedFileWithStatus, status, unreported(app)); nil != err {
+		return sum, err
+	}
+
+	sort.Strings(del)
+	sum.Del = len(del)
+	if err := report(take.DelFile, take.DelFileWithStatus, status, del); nil != err {
+		return sum, err
+	}
+
+	if opt.update {
+		if opt.dryRun {
+			if opt.preview != nil {
+				data, err := ros.Marshal()
+				if nil != err {
+					return sum, fmt.Errorf("ros.Marshal(): %s\n", err)
+				}
+				if _, err := opt.preview.Write(data); nil != err {
+					return sum, err
+				}
+			}
+		} else if nil != opt.stdout {
+			if _, err := ros.WriteTo(opt.stdout); nil != err {
+				return sum, fmt.Errorf("ros.WriteTo(): %s\n", err)
 			}
+		} else if err := ros.Write(); nil != err {
+			return sum, fmt.Errorf("ros.Write(): %s\n", err)
 		}
+	}
+
+	if len(werr) > 0 {
+		return sum, werr
+	}
+	return sum, nil
+}
 
-		if update {
-			if err := ros.Write(); nil != err {
-				return fmt.Errorf("ros.Write(): %s\n", err)
+// searchParents returns each of the given directory paths replaced by the path
+// of the nearest directory containing a roster file with the given file name,
+// searching the directory itself and then each of its parent directories in
+// turn. A directory path is unchanged if no roster file is found. Directories
+// found more than once are only returned once.
+func searchParents(filename string, path ...string) []string {
+	found := []string{}
+	seen := map[string]bool{}
+	for _, dir := range path {
+		root := dir
+		if abs, err := filepath.Abs(dir); nil == err {
+			// the parent directories are given relative to the directory path
+			// as it was given
+			for up := dir; ; up = filepath.Join(up, "..") {
+				if _, err := os.Stat(filepath.Join(abs, filename)); nil == err {
+					root = filepath.Clean(up)
+					break
+				}
+				parent := filepath.Dir(abs)
+				if parent == abs {
+					break
+				}
+				abs = parent
+			}
+		}
+		if key, err := filepath.Abs(root); nil != err || !seen[key] {
+			seen[key] = true
+			found = append(found, root)
+		}
+	}
+	return found
+}
+
+// errStopped is returned by walkDir if the scan was stopped by an error in
+// another directory before any files were reported.
+var errStopped = errors.New("scan stopped")
+
+// serialize returns the given Taker with its Progress, Skipped, EnteredDir, and
+// SkippedDir handlers modified to hold the given lock, so that they are never
+// called concurrently by different directory walks.
+func serialize(take Taker, lk *sync.Mutex) Taker {
+	if prog := take.Progress; nil != prog {
+		take.Progress = func(scanned, total int, hashed int64, path string) {
+			lk.Lock()
+			defer lk.Unlock()
+			prog(scanned, total, hashed, path)
+		}
+	}
+	if skip := take.Skipped; nil != skip {
+		take.Skipped = func(path, reason string) {
+			lk.Lock()
+			defer lk.Unlock()
+			skip(path, reason)
+		}
+	}
+	if enter := take.EnteredDir; nil != enter {
+		take.EnteredDir = func(path string) {
+			lk.Lock()
+			defer lk.Unlock()
+			enter(path)
+		}
+	}
+	if skip := take.SkippedDir; nil != skip {
+		take.SkippedDir = func(path, reason string) {
+			lk.Lock()
+			defer lk.Unlock()
+			skip(path, reason)
+		}
+	}
+	return take
+}
+
+// Incomplete parses the roster file in each of the given directory paths and
+// calls the given Handler for each member whose recorded Status is missing one
+// of the attributes enabled for verification. The roster files are never
+// modified.
+func Incomplete(incomplete Handler, filename string, path ...string) error {
+
+	if len(path) == 0 {
+		return errors.New("no directory path(s) provided")
+	}
+
+	for _, dir := range path {
+		if err := incompleteIn(incomplete, filepath.Join(dir, filename)); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// incompleteIn calls the given Handler, if not nil, for each member of the
+// roster file at the given path with incomplete Status (see Incomplete), and
+// closes the roster file before returning.
+func incompleteIn(incomplete Handler, path string) error {
+	ros, err := file.Parse(path)
+	if nil != err {
+		return fmt.Errorf("file.Parse(): %s\n", err.Error())
+	}
+	defer ros.Close()
+
+	if incomplete != nil {
+		for _, s := range ros.IncompleteMembers() {
+			if err := incomplete(s); nil != err {
+				return err
 			}
 		}
 	}
 	return nil
 }
+
+// Init writes a new roster file with default configuration and no members in
+// each of the given directory paths, with each configuration setting documented
+// by a comment if the roster file is in YAML format. Returns an error without
+// writing any more roster files if one already exists.
+func Init(filename string, path ...string) error {
+
+	if len(path) == 0 {
+		return errors.New("no directory path(s) provided")
+	}
+
+	for _, dir := range path {
+		if stat, err := os.Stat(dir); nil != err {
+			return fmt.Errorf("os.Stat(): %s\n", err.Error())
+		} else if !stat.IsDir() {
+			return file.InvalidPathError(dir)
+		}
+		path := filepath.Join(dir, filename)
+		if _, err := os.Lstat(path); nil == err {
+			return &os.PathError{Op: "init", Path: path, Err: os.ErrExist}
+		}
+		if err := file.New(false, path).WriteDocumented(); nil != err {
+			return fmt.Errorf("ros.WriteDocumented(): %s\n", err)
+		}
+	}
+	return nil
+}
+
+// Verify parses the given roster file and verifies the given target directory
+// contains each of its members with a matching Status, per the roster's Verify
+// settings, such as when validating a restored backup against the roster of
+// its source directory. Members missing from the target directory are passed
+// to the DelFile handler of the given Taker, and members whose Status does not
+// match are passed to the BadFile handler. Files in the target directory that
+// are not members are never reported, and the roster file is never modified.
+// Returns a Summary of all files reported. Errors encountered with individual
+// files do not stop verification. Instead, they are all returned together as
+// walk.Errors once all members have been verified.
+func Verify(take Taker, rosterFile string, targetDir string) (Summary, error) {
+
+	sum := Summary{Path: targetDir}
+	start := time.Now()
+
+	if stat, err := os.Stat(targetDir); nil != err {
+		return sum, fmt.Errorf("os.Stat(): %s\n", err.Error())
+	} else if !stat.IsDir() {
+		return sum, file.InvalidPathError(targetDir)
+	}
+	// a missing roster file would otherwise be parsed as an empty roster
+	if _, err := os.Stat(rosterFile); nil != err {
+		return sum, fmt.Errorf("os.Stat(): %s\n", err.Error())
+	}
+	ros, err := file.Parse(rosterFile)
+	if nil != err {
+		return sum, fmt.Errorf("file.Parse(): %s\n", err.Error())
+	}
+	defer ros.Close()
+
+	del, bad, werr := walk.Verify(targetDir, ros, progress(&sum, take.Progress))
+	if nil != werr {
+		if _, ok := werr.(walk.Errors); !ok {
+			return sum, werr
+		}
+	}
+	sort.Strings(del)
+	mis := make([]string, 0, len(bad))
+	for s := range bad {
+		mis = append(mis, s)
+	}
+	sort.Strings(mis)
+	sum.Del, sum.Bad = len(del), len(mis)
+	sum.Elapsed = time.Since(start)
+
+	// the roster's Status is the prior Status of each file
+	status := func(filePath string) (file.Status, file.Status) {
+		old, _ := ros.Status(filePath)
+		new, ok := bad[filePath]
+		if !ok {
+			new = file.NoStatus()
+		}
+		return old, new
+	}
+
+	if err := report(take.BadFile, take.BadFileWithStatus, status, mis); nil != err {
+		return sum, err
+	}
+	if err := report(take.DelFile, take.DelFileWithStatus, status, del); nil != err {
+		return sum, err
+	}
+	return sum, werr
+}
+
+// Manifest writes the checksums recorded with the given algorithm in the roster
+// file in the given directory path to the given io.Writer, in the same format
+// as coreutils (see file.Roster.ExportManifest). The roster file is never
+// modified.
+func Manifest(w io.Writer, filename string, algo string, path string) error {
+	ros, err := file.Parse(filepath.Join(path, filename))
+	if nil != err {
+		return fmt.Errorf("file.Parse(): %s\n", err.Error())
+	}
+	defer ros.Close()
+	return ros.ExportManifest(w, algo)
+}
+
+// Compare walks the two given directory trees, constructing an in-memory roster
+// index of each with the given configuration, and reports their differences
+// using the given Taker. Both trees are filtered by the same Ign and Inc
+// patterns of the configuration (see file.DefaultConfig). Directory origPath is
+// treated as the original tree and currPath as the current tree, so files found
+// only in currPath are reported as new, files found only in origPath are
+// reported as deleted, and files found in both whose Status differ per the Ver
+// settings of the configuration are reported as modified. No roster file is
+// read from or written to disk, but files with the given roster file name are
+// still excluded from both trees. Returns a Summary of all files reported.
+func Compare(take Taker, filename string, cfg file.Config, origPath, currPath string) (Summary, error) {
+
+	var sum Summary
+	start := time.Now()
+
+	var errs walk.Errors
+	ros := make([]*file.Roster, 2)
+	for i, dir := range []string{origPath, currPath} {
+		if stat, err := os.Stat(dir); nil != err {
+			return sum, fmt.Errorf("os.Stat(): %s\n", err.Error())
+		} else if !stat.IsDir() {
+			return sum, file.InvalidPathError(dir)
+		}
+		var err error
+		if ros[i], err = file.NewWithConfig(filepath.Join(dir, filename), cfg); nil != err {
+			return sum, err
+		}
+		var tree Summary
+		_, _, _, _, _, err = walk.Walk(dir, ros[i], progress(&tree, take.Progress), take.Skipped, take.dirs())
+		sum.Scanned += tree.Scanned
+		sum.Hashed += tree.Hashed
+		if nil != err {
+			if werr, ok := err.(walk.Errors); ok {
+				errs = append(errs, werr...)
+			}
+		}
+	}
+
+	if err := reportDiff(take, &sum, start, ros[0], ros[1], cfg.Ver); nil != err {
+		return sum, err
+	}
+	if len(errs) > 0 {
+		return sum, errs
+	}
+	return sum, nil
+}
+
+// Diff parses the two given roster files and reports the differences between
+// their recorded members using the given Taker, without reading the directory
+// trees they index. Roster file origFile is treated as the original roster and
+// currFile as the current roster, so files recorded only in currFile are
+// reported as new, files recorded only in origFile are reported as deleted, and
+// files recorded in both whose Status differ per the given Verify settings are
+// reported as modified. Returns a Summary of all files reported.
+func Diff(take Taker, ver file.Verify, origFile, currFile string) (Summary, error) {
+
+	var sum Summary
+	start := time.Now()
+
+	ros := make([]*file.Roster, 2)
+	for i, path := range []string{origFile, currFile} {
+		// a missing roster file would otherwise be parsed as an empty roster
+		if _, err := os.Stat(path); nil != err {
+			return sum, fmt.Errorf("os.Stat(): %s\n", err.Error())
+		}
+		var err error
+		if ros[i], err = file.Parse(path); nil != err {
+			return sum, fmt.Errorf("file.Parse(): %s\n", err.Error())
+		}
+		defer ros[i].Close()
+	}
+
+	// sum is modified by reportDiff, so it must be returned afterward
+	err := reportDiff(take, &sum, start, ros[0], ros[1], ver)
+	return sum, err
+}
+
+// reportDiff reports the differences between the members of the given original
+// and current Rosters using the given Taker, and records their tallies and the
+// time elapsed since the given start time in the given Summary.
+func reportDiff(take Taker, sum *Summary, start time.Time,
+	orig, curr *file.Roster, ver file.Verify) error {
+
+	new, del, mod := file.Diff(orig, curr, ver)
+	sum.New, sum.Mod, sum.Del = len(new), len(mod), len(del)
+	sum.Elapsed = time.Since(start)
+
+	// the original roster's Status is the prior Status of each file
+	status := func(filePath string) (file.Status, file.Status) {
+		old, _ := orig.Status(filePath)
+		new, _ := curr.Status(filePath)
+		return old, new
+	}
+
+	if err := report(take.NewFile, take.NewFileWithStatus, status, new); nil != err {
+		return err
+	}
+	if err := report(take.ModFile, take.ModFileWithStatus, status, mod); nil != err {
+		return err
+	}
+	return report(take.DelFile, take.DelFileWithStatus, status, del)
+}
@@ -0,0 +1,191 @@
+package roster
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/ardnew/roster/file"
+)
+
+// writeRoster writes a roster file with the given members and default
+// configuration to the given directory.
+func writeRoster(t *testing.T, dir string, mem map[string]file.Status) {
+	t.Helper()
+	ros := file.New(false, filepath.Join(dir, DefaultFileName))
+	for filePath, stat := range mem {
+		if err := ros.Update(filePath, stat); nil != err {
+			t.Fatalf("Update(%q): %v", filePath, err)
+		}
+	}
+	if err := ros.Write(); nil != err {
+		t.Fatalf("Write(): %v", err)
+	}
+}
+
+// testStatus returns the Status of a regular file with the given size and
+// checksums, and all other attributes recorded.
+func testStatus(size int64, sums file.Checksums) file.Status {
+	return file.Status{
+		Fsize: size,
+		Perms: "-rw-r--r--",
+		Mtime: "2020-01-01T00:00:00Z",
+		Check: sums,
+		Owner: "0:0",
+	}
+}
+
+func TestIncomplete(t *testing.T) {
+	sum := file.Checksums{file.HashXXHash: file.HashXXHash + file.HashSep + "0123456789abcdef"}
+	a, b := t.TempDir(), t.TempDir()
+	writeRoster(t, a, map[string]file.Status{
+		"complete": testStatus(1, sum),
+		"no-check": testStatus(1, file.Checksums{}),
+		"no-size":  testStatus(file.StatusNoFsize, sum),
+	})
+	writeRoster(t, b, map[string]file.Status{
+		"complete": testStatus(1, sum),
+		"empty":    testStatus(0, sum),
+	})
+
+	var got []string
+	err := Incomplete(func(filePath string) error {
+		got = append(got, filePath)
+		return nil
+	}, DefaultFileName, a, b)
+	if nil != err {
+		t.Fatalf("Incomplete(): %v", err)
+	}
+	if want := []string{"no-check", "no-size"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Incomplete(): reported %q, want %q", got, want)
+	}
+
+	if err := Incomplete(nil, DefaultFileName, filepath.Join(a, "missing")); nil == err {
+		t.Errorf("Incomplete(): no error with missing roster file")
+	}
+}
+
+// writeTree creates each of the given files, with the given content, in the
+// given directory.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); nil != err {
+			t.Fatalf("MkdirAll(): %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); nil != err {
+			t.Fatalf("WriteFile(): %v", err)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	orig, curr := t.TempDir(), t.TempDir()
+	writeTree(t, orig, map[string]string{
+		"same":        "unchanged",
+		"sub/changed": "original",
+		"removed":     "removed",
+		"orig.log":    "ignored",
+	})
+	writeTree(t, curr, map[string]string{
+		"same":        "unchanged",
+		"sub/changed": "modified",
+		"sub/added":   "added",
+		"curr.log":    "ignored",
+	})
+
+	cfg := file.DefaultConfig()
+	cfg.Ign = file.Ignore{`\.log$`}
+	cfg.Ver.Mtime = false // the trees are written at different times
+
+	var add, mod, del []string
+	take := Taker{
+		NewFile: func(filePath string) error { add = append(add, filePath); return nil },
+		ModFile: func(filePath string) error { mod = append(mod, filePath); return nil },
+		DelFile: func(filePath string) error { del = append(del, filePath); return nil },
+	}
+	sum, err := Compare(take, DefaultFileName, cfg, orig, curr)
+	if nil != err {
+		t.Fatalf("Compare(): %v", err)
+	}
+	for _, c := range []struct {
+		kind      string
+		got, want []string
+	}{
+		{"new", add, []string{"sub/added"}},
+		{"modified", mod, []string{"sub/changed"}},
+		{"deleted", del, []string{"removed"}},
+	} {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("Compare(): reported %s %q, want %q", c.kind, c.got, c.want)
+		}
+	}
+	if sum.New != 1 || sum.Mod != 1 || sum.Del != 1 {
+		t.Errorf("Compare(): summary %+v, want 1 new, 1 modified, 1 deleted", sum)
+	}
+}
+
+func TestStream(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{}
+	for i := 0; i < 20; i++ {
+		files["f"+strconv.Itoa(i)] = "original"
+	}
+	writeTree(t, dir, files)
+	if _, err := Take(Taker{}, DefaultFileName, true, dir); nil != err {
+		t.Fatalf("Take(): %v", err)
+	}
+	for name := range files {
+		files[name] = "modified"
+	}
+	writeTree(t, dir, files)
+	if err := os.Remove(filepath.Join(dir, "f0")); nil != err {
+		t.Fatal(err)
+	}
+	rosterPath := filepath.Join(dir, DefaultFileName)
+	before, err := os.ReadFile(rosterPath)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// the scan stops, without updating the roster file, once the context is
+	// canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	events, errs := Stream(ctx, DefaultFileName, true, dir)
+	if ev, ok := <-events; !ok || ChangeMod != ev.Kind {
+		t.Fatalf("Stream(): first event %+v, want %s", ev, ChangeMod)
+	}
+	cancel()
+	for range events {
+	}
+	if err := <-errs; context.Canceled != err {
+		t.Fatalf("Stream(): error %v, want %v", err, context.Canceled)
+	}
+	if after, err := os.ReadFile(rosterPath); nil != err {
+		t.Fatal(err)
+	} else if !bytes.Equal(before, after) {
+		t.Errorf("Stream(): roster file updated after context canceled")
+	}
+
+	// modified files are sent as they are found, and deleted files once the
+	// walk finishes
+	kinds := map[string]int{}
+	var last string
+	events, errs = Stream(context.Background(), DefaultFileName, false, dir)
+	for ev := range events {
+		kinds[ev.Kind]++
+		last = ev.Kind
+	}
+	if err := <-errs; nil != err {
+		t.Fatalf("Stream(): %v", err)
+	}
+	if kinds[ChangeMod] != len(files)-1 || kinds[ChangeDel] != 1 || ChangeDel != last {
+		t.Errorf("Stream(): sent %v ending with %s, want %d %s then 1 %s",
+			kinds, last, len(files)-1, ChangeMod, ChangeDel)
+	}
+}
@@ -0,0 +1,71 @@
+package roster
+
+import (
+	"context"
+
+	"github.com/ardnew/roster/file"
+)
+
+// Event describes a single file reported by Stream.
+type Event struct {
+	Kind   string      // kind of change (e.g., ChangeNew)
+	Path   string      // file path, or new path if moved
+	From   string      // original path if moved, otherwise empty
+	Old    file.Status // previously recorded Status, or file.NoStatus() if new or moved
+	Status file.Status // current Status, or file.NoStatus() if deleted or moved
+}
+
+// Stream takes a roster of each of the given directory paths the same as Take,
+// but sends each file reported as an Event on the returned Event channel
+// instead of passing them to handlers. New and modified files are sent as soon
+// as they are processed during the walk, in no particular order, while deleted
+// and moved files are sent once the walk of their directory finishes. If moves
+// can be identified (i.e., checksums are verified), new files are also sent
+// once the walk finishes, since they may have been moved. Each Event is only
+// sent once it can be received, so a slow receiver pauses the walk. Once all
+// files have been reported, the Event channel is closed, and the error returned
+// by Take, if any, is sent on the returned error channel, which is then closed.
+// If the given context is done before the scan finishes, the walk is stopped,
+// no more Events are sent, the roster files are not updated, and the context's
+// error is sent on the error channel instead.
+func Stream(ctx context.Context, filename string, update bool, path ...string) (
+	<-chan Event, <-chan error,
+) {
+	events := make(chan Event)
+	errs := make(chan error, 1)
+
+	go func() {
+		emit := func(c Change) error {
+			ev := Event{
+				Kind: c.Change, Path: c.Path, From: c.From,
+				Old: file.NoStatus(), Status: file.NoStatus(),
+			}
+			if nil != c.Old {
+				ev.Old = *c.Old
+			}
+			if nil != c.New {
+				ev.Status = *c.New
+			}
+			select {
+			case events <- ev:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		err := ctx.Err()
+		if nil == err {
+			_, err = walkAll(options{
+				take: changeTaker(emit), filename: filename, update: update,
+				dirs: path, depth: -1, ctx: ctx, stream: true,
+			})
+		}
+		if nil != err {
+			errs <- err
+		}
+		close(events)
+		close(errs)
+	}()
+
+	return events, errs
+}
@@ -0,0 +1,21 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package walk
+
+import "os"
+
+// fileID uniquely identifies a file on the system.
+type fileID struct{}
+
+// idOf returns false, as unique file identification is not supported on this
+// platform.
+func idOf(info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
+
+// sameDevice returns true, as the device of a file cannot be determined on this
+// platform.
+func (id fileID) sameDevice(oth fileID) bool {
+	return true
+}
@@ -0,0 +1,29 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package walk
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID uniquely identifies a file on the system by device and inode number.
+type fileID struct {
+	dev, ino uint64
+}
+
+// idOf returns the fileID of the given file, and false if it cannot be
+// determined.
+func idOf(info os.FileInfo) (fileID, bool) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+	}
+	return fileID{}, false
+}
+
+// sameDevice returns whether or not the receiver fileID id and the given fileID
+// oth identify files on the same device.
+func (id fileID) sameDevice(oth fileID) bool {
+	return id.dev == oth.dev
+}
@@ -0,0 +1,57 @@
+package walk
+
+import (
+	"context"
+	"os"
+
+	"github.com/ardnew/roster/file"
+)
+
+// Prune traverses a directory tree the same as Walk, but only to identify the
+// recorded files that no longer exist, which are removed from the roster and
+// returned as a list sorted by path. No file is hashed, and the Status of each
+// recorded file found is left unchanged, so new, modified, and moved files are
+// never identified. A moved file is considered deleted from its original path.
+// If the given Progress is not nil, it is called after each file is found, with
+// zero bytes hashed. If the given Skip is not nil, it is called for each file
+// and directory excluded from the traversal, and the handlers of the given Dirs
+// are called as each directory is traversed or not traversed.
+// Errors encountered with individual files do not stop the traversal. Instead,
+// they are all returned as Errors, or nil if no errors were encountered.
+func Prune(filePath string, roster *file.Roster, progress Progress, skip Skip, dirs Dirs) (
+	del []string, err error,
+) {
+
+	roster.SetRoot(filePath)
+
+	var errs Errors
+	report := func(op string, path string, err error) {
+		if _, ok := err.(*os.PathError); !ok {
+			err = &os.PathError{Op: op, Path: path, Err: err}
+		}
+		errs = append(errs, err)
+	}
+
+	var scanned int
+	werr := traverse(context.Background(), filePath, roster, skip, dirs, report, func(in Info) {
+		roster.Present(in.path)
+		if nil != progress {
+			scanned++
+			progress(scanned, -1, 0, in.path)
+		}
+	})
+	if nil != werr {
+		// every recorded file would be considered missing
+		return []string{}, append(errs, werr)
+	}
+
+	del = roster.Absentees()
+	for _, s := range del {
+		roster.Expel(s)
+	}
+
+	if len(errs) > 0 {
+		return del, errs
+	}
+	return del, nil
+}
@@ -0,0 +1,91 @@
+package walk
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/ardnew/roster/file"
+)
+
+// Verify checks that the directory tree at the given path contains each member
+// of the given roster with a matching Status, per the roster's Verify settings,
+// and returns a list of all members that do not exist in the directory tree and
+// the current Status of each member whose Status does not match. Unlike Walk,
+// the directory tree is never traversed, so files that are not members of the
+// roster are never considered, and the roster index is never modified.
+// If the given Progress is not nil, it is called after each member is checked.
+// Errors encountered with individual files do not stop verification. Instead,
+// they are all returned as Errors, or nil if no errors were encountered.
+func Verify(filePath string, roster *file.Roster, progress Progress) (
+	del []string, bad map[string]file.Status, err error,
+) {
+
+	mem := roster.Members()
+	del = []string{}
+	bad = map[string]file.Status{}
+
+	threads := roster.Cfg.Rt.Thr
+	if file.RuntimeThreadsNoLimit == threads {
+		threads = runtime.NumCPU()
+	}
+
+	var errs Errors
+	var scanned int
+	var hashed int64
+	var lk sync.Mutex // guards all of the above results
+
+	queue := make(chan string, threads)
+	var work sync.WaitGroup
+	work.Add(threads)
+
+	for i := 0; i < threads; i++ {
+		go func() {
+			defer work.Done()
+			for relPath := range queue {
+				path := filepath.Join(filePath, filepath.FromSlash(relPath))
+				var size int64
+				stat := file.NoStatus()
+				info, err := os.Lstat(path)
+				missing := os.IsNotExist(err)
+				if nil == err {
+					if stat, err = file.MakeStatus(filePath, relPath, info, roster.Cfg); nil == err {
+						size = hashSize(roster.Cfg, info)
+					}
+				}
+				lk.Lock()
+				switch {
+				case missing:
+					del = append(del, relPath)
+				case nil != err:
+					if _, ok := err.(*os.PathError); !ok {
+						err = &os.PathError{Op: "Verify", Path: relPath, Err: err}
+					}
+					errs = append(errs, err)
+				default:
+					if prev, ok := roster.Status(relPath); ok && !prev.Equals(stat, roster.Cfg.Ver) {
+						bad[relPath] = stat
+					}
+				}
+				scanned++
+				hashed += size
+				if nil != progress {
+					progress(scanned, len(mem), hashed, relPath)
+				}
+				lk.Unlock()
+			}
+		}()
+	}
+
+	for _, relPath := range mem {
+		queue <- relPath
+	}
+	close(queue)
+	work.Wait()
+
+	if len(errs) > 0 {
+		return del, bad, errs
+	}
+	return del, bad, nil
+}
@@ -4,10 +4,12 @@
 package walk
 
 import (
-	"fmt"
+	"context"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 
@@ -15,24 +17,111 @@ import (
 )
 
 // Info stores a unique description of a complete file path (relative) along
-// with its os.FileInfo obtained from filepath.Walk.
+// with its fs.DirEntry obtained from filepath.WalkDir, and its os.FileInfo if
+// it was already obtained.
 type Info struct {
-	path string
-	info os.FileInfo
+	path  string
+	entry fs.DirEntry
+	info  os.FileInfo
+}
+
+// Errors stores all errors encountered while walking a directory tree.
+type Errors []error
+
+// Error returns the error messages of all errors in the receiver Errors e, one
+// per line.
+func (e Errors) Error() string {
+	msg := make([]string, len(e))
+	for i, err := range e {
+		msg[i] = err.Error()
+	}
+	return strings.Join(msg, "\n")
+}
+
+// Progress is called each time a file has been processed during a walk, with
+// the number of files processed so far, the total number of files that will be
+// processed (or -1 if the directory tree has not yet been fully traversed), the
+// number of bytes hashed so far, and the path of the file just processed.
+// Calls to Progress are never made concurrently.
+type Progress func(scanned int, total int, hashed int64, path string)
+
+// Skip is called with the path of each file or directory excluded from the walk,
+// along with a description of the reason it was excluded. Calls to Skip are
+// never made concurrently.
+type Skip func(path string, reason string)
+
+// Enter is called with the path of each directory traversed during a walk,
+// including the root directory ("."), before any file beneath it is excluded or
+// processed. Calls to Enter are never made concurrently.
+type Enter func(path string)
+
+// Dirs contains the handlers called as directories are traversed during a walk,
+// so that the traversal can be observed (e.g., to display progress). Each
+// handler is only called if not nil. A directory whose entries cannot be read
+// is passed to Skip after it was passed to Enter.
+type Dirs struct {
+	Enter Enter // called for each directory traversed
+	Skip  Skip  // called for each directory not traversed, in addition to Skip
+}
+
+// Found is called with the path of each file found new or changed during a walk,
+// as soon as it has been processed, along with whether it is new, and whether
+// it changed only by appending content to it (see file.Status.Appended). A new
+// file passed to Found may still be identified as moved once the walk finishes.
+// Calls to Found are never made concurrently.
+type Found func(path string, new bool, appended bool)
+
+// Move represents a recorded file that no longer exists at path From, but whose
+// content was found at the new path To.
+type Move struct {
+	From string
+	To   string
 }
 
 // Walk traverses a directory tree recursively, constructing a roster index file
-// along the way, and returns a list of all new files discovered and a list of
-// all existing files that have changed since they were last recorded.
-func Walk(filePath string, roster *file.Roster) (new []string, mod []string, del []string) {
+// along the way, and returns a list of all new files discovered, a list of all
+// existing files that have changed since they were last recorded, a list of all
+// existing files that have changed only by appending content to them (see
+// file.Status.Appended), a list of all recorded files that no longer exist, and
+// a list of all recorded files that were moved to a new path. A file is only
+// considered moved if checksums are enabled and its checksums uniquely identify
+// both its original and new path; otherwise, its original path is considered
+// deleted and its new path is considered new.
+// If the given Progress is not nil, it is called after each file is processed.
+// If the given Skip is not nil, it is called for each file and directory
+// excluded from the walk. The handlers of the given Dirs are called as each
+// directory is traversed or not traversed.
+// Errors encountered with individual files do not stop the walk. Instead, they
+// are all returned as Errors, or nil if no errors were encountered.
+func Walk(filePath string, roster *file.Roster, progress Progress, skip Skip, dirs Dirs) (
+	new []string, mod []string, app []string, del []string, mov []Move, err error,
+) {
+	return WalkContext(context.Background(), filePath, roster, progress, skip, dirs, nil)
+}
+
+// WalkContext walks a directory tree the same as Walk, but stops once the given
+// context is done, in which case the files processed so far are returned along
+// with the context's error, and no recorded file is considered deleted or moved
+// (nor removed from the roster), since the directory tree was not fully
+// traversed. If the given Found is not nil, it is called with each new and
+// changed file as soon as it has been processed.
+func WalkContext(ctx context.Context, filePath string, roster *file.Roster,
+	progress Progress, skip Skip, dirs Dirs, found Found) (
+	new []string, mod []string, app []string, del []string, mov []Move, err error,
+) {
 
 	new = []string{}
 	mod = []string{}
+	app = []string{}
 	del = []string{}
 
+	// identify the roster file by its path relative to the root directory
+	roster.SetRoot(filePath)
+
 	// funnel the worker goroutines' output into shared slices of strings
 	funnelNew := make(chan string)
 	funnelMod := make(chan string)
+	funnelApp := make(chan string)
 
 	funnel := func(ret *[]string, grp *sync.WaitGroup, fun chan string) {
 		for s := range fun {
@@ -49,6 +138,10 @@ func Walk(filePath string, roster *file.Roster) (new []string, mod []string, del
 	waitMod.Add(1)
 	go funnel(&mod, &waitMod, funnelMod)
 
+	waitApp := sync.WaitGroup{}
+	waitApp.Add(1)
+	go funnel(&app, &waitApp, funnelApp)
+
 	// use the number of threads specified in roster file's configuration
 	threads := roster.Cfg.Rt.Thr
 	if file.RuntimeThreadsNoLimit == threads {
@@ -56,67 +149,381 @@ func Walk(filePath string, roster *file.Roster) (new []string, mod []string, del
 		threads = runtime.NumCPU()
 	}
 
-	// unbuffered channel, so we have to ensure all receivers are ready before
-	// filepath.Walk begins sending files to the channel.
+	// collect errors from the worker goroutines and filepath.WalkDir
+	var errs Errors
+	var errlk sync.Mutex
+	report := func(op string, path string, err error) {
+		// errors that already identify their path are recorded unchanged
+		if _, ok := err.(*os.PathError); !ok {
+			err = &os.PathError{Op: op, Path: path, Err: err}
+		}
+		errlk.Lock()
+		errs = append(errs, err)
+		errlk.Unlock()
+	}
+
+	// report progress from the worker goroutines, one at a time
+	var scanned, queued int
+	var hashed int64
+	total := -1
+	var proglk sync.Mutex
+	advance := func(path string, size int64) {
+		if nil == progress {
+			return
+		}
+		proglk.Lock()
+		scanned++
+		hashed += size
+		progress(scanned, total, hashed, path)
+		proglk.Unlock()
+	}
+
+	// report new and changed files from the worker goroutines, one at a time
+	var foundlk sync.Mutex
+	changed := func(path string, new bool, appended bool) {
+		if nil == found {
+			return
+		}
+		foundlk.Lock()
+		found(path, new, appended)
+		foundlk.Unlock()
+	}
+
+	// buffered channel, so that filepath.WalkDir may continue discovering files
+	// while all of the worker goroutines are busy.
+	ahead := roster.Cfg.Rt.Queue
+	if ahead <= 0 {
+		ahead = file.RuntimeQueueDefault
+	}
+	queue := make(chan Info, threads*ahead)
+
+	// the WaitGroup counts worker goroutines, not queued files. Each worker
+	// only finishes once the queue is closed and drained, which happens only
+	// after filepath.WalkDir has returned and every file has been sent. Thus,
+	// once Wait returns, every file sent to the queue has been processed,
+	// regardless of how quickly the workers drain the queue relative to the
+	// rate files are discovered.
 	var work sync.WaitGroup
-	queue := make(chan Info)
+	work.Add(threads)
 
 	// spawn worker goroutines to process multiple files simultaneously
 	for i := 0; i < threads; i++ {
-		go func(w *sync.WaitGroup, d string, q chan Info, r *file.Roster, n, m chan string) {
+		go func(w *sync.WaitGroup, d string, q chan Info, r *file.Roster, n, m, a chan string) {
+			defer w.Done()
 			for in := range q {
-				// determine if the file is new or changed
-				if new, mod, stat, err := r.Changed(d, in.path, in.info); nil != err {
-					fmt.Printf("error: Changed(): %s: %s\n", err.Error(), in.path)
+				// drain the queue without processing once the walk is stopped
+				if nil != ctx.Err() {
+					continue
+				}
+				// obtain the file attributes deferred by filepath.WalkDir
+				info, err := in.info, error(nil)
+				if nil == info {
+					info, err = in.entry.Info()
+				}
+				var size int64
+				if nil != err {
+					report("Info", in.path, err)
+				} else if new, mod, stat, err := r.Changed(d, in.path, info); nil != err {
+					// determine if the file is new or changed
+					report("Changed", in.path, err)
 				} else {
+					// the file is not hashed if its change was already detected
+					if len(stat.Check) > 0 {
+						size = hashSize(r.Cfg, info)
+					}
 					// update the roster index (in-memory) with current file attributes
 					if err := r.Update(in.path, stat); nil != err {
-						fmt.Printf("error: Update(): %s: %s\n", err.Error(), in.path)
+						report("Update", in.path, err)
 					} else {
 						if new {
 							n <- in.path
+						} else if mod && stat.Appended() {
+							a <- in.path
 						} else if mod {
 							m <- in.path
 						}
+						if new || mod {
+							changed(in.path, new, !new && stat.Appended())
+						}
 					}
 				}
-				w.Done()
+				advance(in.path, size)
 			}
-		}(&work, filePath, queue, roster, funnelNew, funnelMod)
+		}(&work, filePath, queue, roster, funnelNew, funnelMod, funnelApp)
 	}
 
-	filepath.Walk(filePath,
-		func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			relPath := strings.TrimPrefix(path, filepath.Clean(filePath)+string(os.PathSeparator))
-			// check if this file is ignored
-			if roster.Keep(relPath, info) {
-				work.Add(1)
-				queue <- Info{relPath, info}
-			}
-			return nil
-		})
+	werr := traverse(ctx, filePath, roster, skip, dirs, report, func(in Info) {
+		queued++
+		queue <- in
+	})
+
+	// the total number of files is now known
+	proglk.Lock()
+	total = queued
+	proglk.Unlock()
 
 	// notify the worker goroutines to clean up, no more files are coming
 	close(queue)
-	// ensure all of the worker goroutines have finished
+	// ensure all of the worker goroutines have drained the queue and finished
 	work.Wait()
 
 	// notify the funnel workers to terminate
 	close(funnelNew)
 	close(funnelMod)
+	close(funnelApp)
 
 	// ensure all output strings have been appended
 	waitNew.Wait()
 	waitMod.Wait()
+	waitApp.Wait()
 
-	// finally, remove all missing files from the roster
+	// recorded files not yet found are unknown, not missing, if the walk was
+	// stopped
+	if err := ctx.Err(); nil != err {
+		return new, mod, app, del, []Move{}, err
+	}
+
+	if nil != werr {
+		errs = append(errs, werr)
+	}
+
+	// identify missing files that were moved to a new path, which is only
+	// possible when checksums are recorded
 	del = roster.Absentees()
+	mov = []Move{}
+	if roster.Cfg.Ver.Check {
+		del, new, mov = moved(roster, del, new)
+	}
+
+	// finally, remove all missing files from the roster
 	for _, s := range del {
 		roster.Expel(s)
 	}
+	for _, m := range mov {
+		roster.Expel(m.From)
+	}
+
+	if len(errs) > 0 {
+		return new, mod, app, del, mov, errs
+	}
+	return new, mod, app, del, mov, nil
+}
+
+// traverse walks the directory tree at the given path, calling the given
+// function with each file that is a candidate for indexing per the given
+// roster's configuration, and calling the given Skip, if not nil, with each
+// file and directory excluded. Recorded files that are found but excluded by
+// size, or are in directories that cannot be read, are marked present in the
+// roster. Errors encountered with individual files are passed to the given
+// function report, and only an error with the root directory itself is
+// returned. The walk stops, returning the context's error, once the given
+// context is done.
+func traverse(ctx context.Context, filePath string, roster *file.Roster, skip Skip, dirs Dirs,
+	report func(op string, path string, err error), keep func(Info)) error {
+
+	// directories not traversed are reported to both handlers
+	skipDir := func(relPath string, reason string) {
+		if nil != skip {
+			skip(relPath, reason)
+		}
+		if nil != dirs.Skip {
+			dirs.Skip(relPath, reason)
+		}
+	}
+
+	// directories already traversed, so that no directory is traversed twice
+	// (e.g., via a bind mount of an ancestor directory)
+	visited := map[fileID]bool{}
+
+	// the device of the root directory, if directories on other devices are
+	// not traversed
+	var root fileID
+	oneFS := false
+	if roster.Cfg.Rt.OneFilesystem {
+		if info, err := os.Stat(filePath); nil == err {
+			root, oneFS = idOf(info)
+		}
+	}
+
+	return filepath.WalkDir(filePath,
+		func(path string, entry fs.DirEntry, err error) error {
+			if err := ctx.Err(); nil != err {
+				return err
+			}
+			if err != nil {
+				// only an error with the root directory itself stops the walk
+				if filepath.Clean(path) == filepath.Clean(filePath) {
+					return err
+				}
+				report("WalkDir", path, err)
+				if nil != entry && entry.IsDir() {
+					// recorded files in the unreadable directory are unknown,
+					// not missing
+					if relPath, err := filepath.Rel(filePath, path); nil == err {
+						relPath = filepath.ToSlash(relPath)
+						if nil != dirs.Skip {
+							dirs.Skip(relPath, "directory cannot be read")
+						}
+						roster.PresentDir(relPath)
+					}
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			// paths are recorded relative to the root directory, regardless of
+			// how the root directory path is written, and with forward slashes
+			// so that the roster is portable between platforms
+			relPath, err := filepath.Rel(filePath, path)
+			if err != nil {
+				report("Rel", path, err)
+				return nil
+			}
+			relPath = filepath.ToSlash(relPath)
+			if entry.IsDir() && filepath.Clean(path) != filepath.Clean(filePath) {
+				// do not descend into directories at the maximum depth, where
+				// files in the root directory itself have depth 1
+				if file.RuntimeDepthNoLimit != roster.Cfg.Rt.Dep &&
+					file.Depth(relPath) >= roster.Cfg.Rt.Dep {
+					skipDir(relPath, "maximum depth reached")
+					// the directory itself is within the maximum depth
+					if roster.Keep(relPath, entry.Type()) && !roster.IgnoredDir(relPath) {
+						keep(Info{relPath, entry, nil})
+					}
+					return filepath.SkipDir
+				}
+				// do not descend into ignored directories
+				if roster.IgnoredDir(relPath) {
+					skipDir(relPath, roster.SkipDirReason(relPath))
+					return filepath.SkipDir
+				}
+			}
+			if entry.IsDir() {
+				// do not descend into directories already traversed
+				if info, err := entry.Info(); nil == err {
+					if id, ok := idOf(info); ok {
+						if oneFS && !id.sameDevice(root) {
+							skipDir(relPath, "different file system")
+							// recorded files on the other device are unknown,
+							// not missing
+							roster.Present(relPath)
+							roster.PresentDir(relPath)
+							return filepath.SkipDir
+						}
+						if visited[id] {
+							skipDir(relPath, "directory already visited")
+							return filepath.SkipDir
+						}
+						visited[id] = true
+					}
+				}
+				if nil != dirs.Enter {
+					dirs.Enter(relPath)
+				}
+				// the directory's git ignore patterns apply to all files
+				// beneath it, which are visited after the directory itself
+				if roster.Cfg.Rt.UseNestedGitignore {
+					if err := roster.Gitignore(path, relPath); nil != err {
+						report("Gitignore", path, err)
+					}
+				}
+			}
+			// a symbolic link resolving to another path in the tree is an alias
+			// of the file at that path, which is indexed (or excluded) on its
+			// own. Other paths never contain symbolic links, since symbolic
+			// links to directories are not followed.
+			if roster.Cfg.Rt.Canonicalize && roster.Cfg.Ver.Link &&
+				entry.Type()&fs.ModeSymlink != 0 {
+				if canon := roster.Canonical(relPath); canon != relPath {
+					if nil != skip {
+						skip(relPath, "alias of "+canon)
+					}
+					return nil
+				}
+			}
+			// check if this file is ignored, using only the file type so that
+			// the file attributes are only obtained for files kept
+			if roster.Keep(relPath, entry.Type()) {
+				var info os.FileInfo
+				// the file attributes are needed now to check the file's size
+				// and modification time, which do not apply to directories
+				rt := roster.Cfg.Rt
+				if (rt.SizeLimited() || rt.TimeLimited()) && !entry.IsDir() {
+					if info, err = entry.Info(); nil != err {
+						report("Info", relPath, err)
+						return nil
+					}
+					reason := ""
+					if !rt.KeepSize(info.Size()) {
+						reason = "size outside limits"
+					} else if !rt.KeepMtime(info.ModTime()) {
+						reason = "modification time outside limits"
+					}
+					if reason != "" {
+						if nil != skip {
+							skip(relPath, reason)
+						}
+						roster.Present(relPath)
+						return nil
+					}
+				}
+				keep(Info{relPath, entry, info})
+			} else if nil != skip && !entry.IsDir() {
+				skip(relPath, roster.SkipReason(relPath, entry.Type()))
+			}
+			return nil
+		})
+}
+
+// moved removes each pair of files from the given lists of deleted and new
+// files that have identical checksums in the given roster, and returns the
+// pairs as a list of Move sorted by original path.
+func moved(roster *file.Roster, del []string, new []string) ([]string, []string, []Move) {
+	pair := roster.Moved(del, new)
+	if len(pair) == 0 {
+		return del, new, []Move{}
+	}
+	dst := map[string]bool{}
+	mov := make([]Move, 0, len(pair))
+	for from, to := range pair {
+		mov = append(mov, Move{From: from, To: to})
+		dst[to] = true
+	}
+	sort.Slice(mov, func(i, j int) bool { return mov[i].From < mov[j].From })
+	keepDel := make([]string, 0, len(del)-len(pair))
+	for _, s := range del {
+		if _, ok := pair[s]; !ok {
+			keepDel = append(keepDel, s)
+		}
+	}
+	keepNew := make([]string, 0, len(new)-len(pair))
+	for _, s := range new {
+		if !dst[s] {
+			keepNew = append(keepNew, s)
+		}
+	}
+	return keepDel, keepNew, mov
+}
+
+// hashSize returns the number of bytes of the given file that are hashed per
+// the given roster configuration.
+func hashSize(cfg file.Config, info os.FileInfo) int64 {
+	if !cfg.Ver.Check || !info.Mode().IsRegular() {
+		return 0
+	}
+	if cfg.Rt.HashHead > file.RuntimeHashHeadNoLimit &&
+		int64(cfg.Rt.HashHead) < info.Size() {
+		return int64(cfg.Rt.HashHead)
+	}
+	return info.Size()
+}
 
-	return new, mod, del
+// SameDevice returns whether or not the two given files are on the same device,
+// or true if the device of either file cannot be determined.
+func SameDevice(a, b os.FileInfo) bool {
+	x, ok := idOf(a)
+	if !ok {
+		return true
+	}
+	y, ok := idOf(b)
+	return !ok || x.sameDevice(y)
 }
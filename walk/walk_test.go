@@ -0,0 +1,182 @@
+package walk
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/ardnew/roster/file"
+)
+
+// makeTree creates the given number of small files in each of the given number
+// of directories beneath a new temporary directory, and returns its path along
+// with the relative path of each file created.
+func makeTree(t *testing.T, dirs, files int) (string, []string) {
+	t.Helper()
+	root := t.TempDir()
+	paths := make([]string, 0, dirs*files)
+	for d := 0; d < dirs; d++ {
+		dir := "d" + strconv.Itoa(d)
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); nil != err {
+			t.Fatal(err)
+		}
+		for f := 0; f < files; f++ {
+			rel := dir + "/f" + strconv.Itoa(f)
+			if err := os.WriteFile(filepath.Join(root, rel), []byte(rel), 0644); nil != err {
+				t.Fatal(err)
+			}
+			paths = append(paths, rel)
+		}
+	}
+	return root, paths
+}
+
+// newRoster returns a new roster of the given directory, processing files with
+// the given number of worker threads, each with at most one file queued.
+func newRoster(root string, threads int) *file.Roster {
+	ros := file.New(false, filepath.Join(root, ".roster.yml"))
+	ros.Cfg.Rt.Thr = threads
+	ros.Cfg.Rt.Queue = 1
+	return ros
+}
+
+// TestWalkAllFilesProcessed verifies that every file discovered is processed
+// before Walk returns, no matter how quickly the workers drain the queue
+// relative to the rate files are discovered. Run with -race.
+func TestWalkAllFilesProcessed(t *testing.T) {
+	root, paths := makeTree(t, 20, 100)
+	for _, threads := range []int{1, 2, 8, 32} {
+		ros := newRoster(root, threads)
+		var scanned int
+		new, mod, app, del, _, err := Walk(root, ros,
+			func(n, _ int, _ int64, _ string) { scanned = n }, nil, Dirs{})
+		if nil != err {
+			t.Fatalf("threads=%d: Walk(): %v", threads, err)
+		}
+		if len(new) != len(paths) || len(mod)+len(app)+len(del) != 0 {
+			t.Fatalf("threads=%d: Walk(): %d new, %d mod, %d app, %d del, want %d new",
+				threads, len(new), len(mod), len(app), len(del), len(paths))
+		}
+		if scanned != len(paths) {
+			t.Fatalf("threads=%d: scanned %d files, want %d", threads, scanned, len(paths))
+		}
+		if mem := ros.Members(); len(mem) != len(paths) {
+			t.Fatalf("threads=%d: Members(): %d members, want %d", threads, len(mem), len(paths))
+		}
+	}
+}
+
+// TestWalkWhileExpelling verifies that members may be expelled, and the list of
+// missing files obtained, while a walk of a populated roster updates them. Run
+// with -race.
+func TestWalkWhileExpelling(t *testing.T) {
+	root, paths := makeTree(t, 10, 100)
+	ros := newRoster(root, 8)
+	if _, _, _, _, _, err := Walk(root, ros, nil, nil, Dirs{}); nil != err {
+		t.Fatalf("Walk(): %v", err)
+	}
+	// files removed after the roster was populated are missing during the
+	// next walk, the same as if the roster had been written and parsed again
+	ros.ResetAbsent()
+	for _, rel := range paths[:len(paths)/4] {
+		if err := os.Remove(filepath.Join(root, rel)); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := len(paths) - 1; i >= 0; i -= 3 {
+			ros.Expel(paths[i])
+			abs := ros.Absentees()
+			for j := 1; j < len(abs); j++ {
+				if abs[j-1] >= abs[j] {
+					t.Errorf("Absentees(): %q precedes %q", abs[j-1], abs[j])
+					return
+				}
+			}
+		}
+	}()
+	_, _, _, del, _, err := Walk(root, ros, nil, nil, Dirs{})
+	<-done
+	if nil != err {
+		t.Fatalf("Walk(): %v", err)
+	}
+
+	// each file reported deleted was removed, and each file removed is
+	// reported deleted, unless it was expelled during the walk
+	removed, expelled := map[string]bool{}, map[string]bool{}
+	for _, rel := range paths[:len(paths)/4] {
+		removed[rel] = true
+	}
+	for i := len(paths) - 1; i >= 0; i -= 3 {
+		expelled[paths[i]] = true
+	}
+	reported := map[string]bool{}
+	for _, rel := range del {
+		reported[rel] = true
+		if !removed[rel] {
+			t.Errorf("Walk(): %q reported deleted, but exists", rel)
+		}
+	}
+	for rel := range removed {
+		if !reported[rel] && !expelled[rel] {
+			t.Errorf("Walk(): %q removed, but not reported deleted", rel)
+		}
+	}
+}
+
+// TestWalkContextCanceled verifies that WalkContext reports files as soon as
+// they are processed, stops once its context is done, and never considers a
+// recorded file missing if the walk was stopped.
+func TestWalkContextCanceled(t *testing.T) {
+	root, paths := makeTree(t, 10, 100)
+	ros := newRoster(root, 4)
+	if _, _, _, _, _, err := Walk(root, ros, nil, nil, Dirs{}); nil != err {
+		t.Fatalf("Walk(): %v", err)
+	}
+	removed := paths[:10]
+	for _, rel := range removed {
+		if err := os.Remove(filepath.Join(root, rel)); nil != err {
+			t.Fatal(err)
+		}
+	}
+	for _, rel := range paths[10:] {
+		if err := os.WriteFile(filepath.Join(root, rel), []byte(rel+" changed"), 0644); nil != err {
+			t.Fatal(err)
+		}
+	}
+	ros.ResetAbsent()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var found int
+	_, mod, _, del, mov, err := WalkContext(ctx, root, ros, nil, nil, Dirs{},
+		func(path string, new bool, appended bool) {
+			if new || appended {
+				t.Errorf("Found(%q): new=%t appended=%t, want modified", path, new, appended)
+			}
+			found++
+			cancel()
+		})
+	if context.Canceled != err {
+		t.Fatalf("WalkContext(): error %v, want %v", err, context.Canceled)
+	}
+	if found == 0 || found != len(mod) {
+		t.Errorf("WalkContext(): found %d files, returned %d modified", found, len(mod))
+	}
+	if len(mod) >= len(paths)-len(removed) {
+		t.Errorf("WalkContext(): %d files modified, want walk stopped", len(mod))
+	}
+	if len(del)+len(mov) != 0 {
+		t.Errorf("WalkContext(): %d deleted, %d moved, want none", len(del), len(mov))
+	}
+	for _, rel := range removed {
+		if _, ok := ros.Status(rel); !ok {
+			t.Errorf("Status(%q): expelled from roster, want unknown", rel)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package roster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ardnew/roster/file"
+	"github.com/ardnew/roster/walk"
+	"github.com/fsnotify/fsnotify"
+)
+
+// WatchInterval is the interval at which Watch writes each roster file to disk,
+// if it has changed since it was last written.
+var WatchInterval = 30 * time.Second
+
+// watchTree contains the roster of a directory tree being watched.
+type watchTree struct {
+	root  string
+	ros   *file.Roster
+	dirty bool // roster has changed since it was last written
+}
+
+// Watch takes a roster of each of the given directory paths and updates each
+// roster file, the same as Take. It then watches each directory tree for
+// changes, passing each new, modified, and deleted file to the respective
+// handlers of the given Taker as they occur, and writes each changed roster
+// file to disk periodically (see WatchInterval). Directories created within a
+// tree are watched as they appear. Moved files are reported as deleted and new
+// files, and BadFile is never called.
+// Watch returns nil once the given context is done, after writing each changed
+// roster file a final time. If a handler returns an error, Watch returns the
+// error without writing the roster files. Errors encountered with individual
+// files are ignored.
+func Watch(ctx context.Context, take Taker, filename string, path ...string) error {
+
+	if len(path) == 0 {
+		return errors.New("no directory path(s) provided")
+	}
+
+	wat, err := fsnotify.NewWatcher()
+	if nil != err {
+		return fmt.Errorf("fsnotify.NewWatcher(): %s\n", err.Error())
+	}
+	defer wat.Close()
+
+	tree, err := watchAll(wat, take, filename, path...)
+	if nil != err {
+		return err
+	}
+	defer func() { closeAll(tree) }()
+
+	tick := time.NewTicker(WatchInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return flush(tree)
+
+		case <-tick.C:
+			if err := flush(tree); nil != err {
+				return err
+			}
+
+		case ev, ok := <-wat.Events:
+			if !ok {
+				return flush(tree)
+			}
+			if t := treeOf(tree, ev.Name); nil != t {
+				if err := t.event(wat, take, ev); nil != err {
+					return err
+				}
+			}
+
+		case _, ok := <-wat.Errors:
+			if !ok {
+				return flush(tree)
+			}
+			// events may have been lost, so take each roster again from scratch
+			if err := flush(tree); nil != err {
+				return err
+			}
+			closeAll(tree)
+			if tree, err = watchAll(wat, take, filename, path...); nil != err {
+				return err
+			}
+		}
+	}
+}
+
+// watchAll takes and updates a roster of each of the given directory paths, and
+// adds each directory in their trees to the given fsnotify.Watcher.
+func watchAll(wat *fsnotify.Watcher, take Taker, filename string, path ...string) ([]*watchTree, error) {
+	// errors encountered with individual files are ignored
+	if _, err := Take(take, filename, true, path...); nil != err {
+		if _, ok := err.(walk.Errors); !ok {
+			return nil, err
+		}
+	}
+	tree := make([]*watchTree, len(path))
+	for i, dir := range path {
+		ros, err := file.Parse(filepath.Join(dir, filename))
+		if nil != err {
+			closeAll(tree[:i])
+			return nil, fmt.Errorf("file.Parse(): %s\n", err.Error())
+		}
+		ros.SetRoot(dir)
+		tree[i] = &watchTree{root: dir, ros: ros}
+		if err := tree[i].watch(wat, dir, nil); nil != err {
+			closeAll(tree[:i+1])
+			return nil, err
+		}
+	}
+	return tree, nil
+}
+
+// flush writes each roster file of the given trees to disk, if it has changed
+// since it was last written.
+func flush(tree []*watchTree) error {
+	for _, t := range tree {
+		if t.dirty {
+			if err := t.ros.Write(); nil != err {
+				return fmt.Errorf("ros.Write(): %s\n", err)
+			}
+			t.dirty = false
+		}
+	}
+	return nil
+}
+
+// closeAll closes the roster of each of the given trees, discarding changes not
+// yet written.
+func closeAll(tree []*watchTree) {
+	for _, t := range tree {
+		t.ros.Close()
+	}
+}
+
+// treeOf returns the tree containing the given file path, preferring the tree
+// with the longest root path if trees are nested, or nil if no tree contains
+// the file path.
+func treeOf(tree []*watchTree, filePath string) *watchTree {
+	var found *watchTree
+	for _, t := range tree {
+		if rel, err := filepath.Rel(t.root, filePath); nil == err &&
+			rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			if nil == found || len(t.root) > len(found.root) {
+				found = t
+			}
+		}
+	}
+	return found
+}
+
+// event handles the given fsnotify.Event for a file path in the receiver
+// watchTree t.
+func (t *watchTree) event(wat *fsnotify.Watcher, take Taker, ev fsnotify.Event) error {
+	rel, err := filepath.Rel(t.root, ev.Name)
+	if nil != err {
+		return nil
+	}
+	rel = filepath.ToSlash(rel)
+	info, err := os.Lstat(ev.Name)
+	if nil != err {
+		// the file or directory no longer exists (e.g., removed or renamed)
+		return t.remove(take, rel)
+	}
+	if info.IsDir() {
+		// only new directories must be watched and scanned
+		if ev.Op&fsnotify.Create != 0 && rel != "." {
+			return t.watch(wat, ev.Name, t.found(take))
+		}
+		// directories are only indexed if enabled (see Runtime.IndexDirs)
+		if rel != "." {
+			return t.update(take, rel, info)
+		}
+		return nil
+	}
+	return t.update(take, rel, info)
+}
+
+// watch adds the given directory and each of its subdirectories not excluded by
+// the receiver watchTree t's roster to the given fsnotify.Watcher. If the given
+// function is not nil, it is called with each file and subdirectory found.
+func (t *watchTree) watch(wat *fsnotify.Watcher, dir string, found func(string, fs.DirEntry) error) error {
+	rt := t.ros.Cfg.Rt
+	var root os.FileInfo
+	if rt.OneFilesystem {
+		root, _ = os.Stat(t.root)
+	}
+	return filepath.WalkDir(dir,
+		func(path string, entry fs.DirEntry, err error) error {
+			if nil != err {
+				if nil != entry && entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			rel, err := filepath.Rel(t.root, path)
+			if nil != err {
+				return nil
+			}
+			rel = filepath.ToSlash(rel)
+			if !entry.IsDir() {
+				if nil != found {
+					return found(rel, entry)
+				}
+				return nil
+			}
+			if rel != "." {
+				if t.ros.IgnoredDir(rel) {
+					return filepath.SkipDir
+				}
+				if nil != root {
+					if info, err := entry.Info(); nil == err && !walk.SameDevice(root, info) {
+						return filepath.SkipDir
+					}
+				}
+				if nil != found {
+					if err := found(rel, entry); nil != err {
+						return err
+					}
+				}
+				if file.RuntimeDepthNoLimit != rt.Dep && file.Depth(rel) >= rt.Dep {
+					return filepath.SkipDir
+				}
+			}
+			if rt.UseNestedGitignore {
+				t.ros.Gitignore(path, rel)
+			}
+			if err := wat.Add(path); nil != err {
+				return fmt.Errorf("wat.Add(): %s\n", err.Error())
+			}
+			return nil
+		})
+}
+
+// found returns a function that updates the receiver watchTree t's roster with
+// each file found in a new directory (and the directory itself), reporting
+// files to the given Taker.
+func (t *watchTree) found(take Taker) func(string, fs.DirEntry) error {
+	return func(rel string, entry fs.DirEntry) error {
+		info, err := entry.Info()
+		if nil != err {
+			return nil
+		}
+		return t.update(take, rel, info)
+	}
+}
+
+// update records the current Status of the given file in the receiver watchTree
+// t's roster, and reports the file if it is new or modified.
+func (t *watchTree) update(take Taker, rel string, info os.FileInfo) error {
+	if !t.ros.Keep(rel, info.Mode()) ||
+		(!info.IsDir() && (!t.ros.Cfg.Rt.KeepSize(info.Size()) ||
+			!t.ros.Cfg.Rt.KeepMtime(info.ModTime()))) {
+		return nil
+	}
+	new, mod, stat, err := t.ros.Changed(t.root, rel, info)
+	if nil != err {
+		return nil
+	}
+	if err := t.ros.Update(rel, stat); nil != err {
+		return nil
+	}
+	t.dirty = true
+	switch {
+	case new:
+		status := func(filePath string) (file.Status, file.Status) {
+			new, _ := t.ros.Status(filePath)
+			return file.NoStatus(), new
+		}
+		return report(take.NewFile, take.NewFileWithStatus, status, []string{rel})
+	case mod && stat.Appended() && take.appends():
+		return report(take.AppendedFile, take.AppendedFileWithStatus, statusOf(t.ros), []string{rel})
+	case mod:
+		return report(take.ModFile, take.ModFileWithStatus, statusOf(t.ros), []string{rel})
+	}
+	return nil
+}
+
+// remove expels the given file, or each file in the given directory, from the
+// receiver watchTree t's roster, and reports each file expelled as deleted.
+func (t *watchTree) remove(take Taker, rel string) error {
+	prefix := rel + "/"
+	if rel == "." {
+		prefix = ""
+	}
+	del := []string{}
+	for _, filePath := range t.ros.Members() {
+		if filePath == rel || strings.HasPrefix(filePath, prefix) {
+			del = append(del, filePath)
+		}
+	}
+	if len(del) == 0 {
+		return nil
+	}
+	for _, s := range del {
+		t.ros.Expel(s)
+	}
+	t.dirty = true
+	return report(take.DelFile, take.DelFileWithStatus, statusOf(t.ros), del)
+}
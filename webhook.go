@@ -0,0 +1,157 @@
+package roster
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/ardnew/roster/file"
+	"github.com/ardnew/roster/walk"
+)
+
+// Settings of each post to the webhook given with WithWebhook. A failed post is
+// retried up to WebhookRetries times, waiting WebhookBackoff before the first
+// retry and twice as long before each retry thereafter. Posts rejected with a
+// client error status (4xx) are never retried.
+var (
+	WebhookTimeout = 10 * time.Second // time allowed for each post
+	WebhookRetries = 3
+	WebhookBackoff = time.Second
+)
+
+// Notice is the body posted in JSON to the webhook given with WithWebhook.
+type Notice struct {
+	Summary Summary  `json:"summary"`
+	Changes []Change `json:"changes"`
+}
+
+// walkNotify walks each directory path the same as walkAll, and then posts a
+// Notice of all files reported to the webhook given with WithWebhook, if any
+// files were reported.
+func walkNotify(opt options) (Summary, error) {
+	url := opt.webhook
+	changes := []Change{}
+	opt.webhook = ""
+	opt.take = merge(opt.take, changeTaker(func(c Change) error {
+		changes = append(changes, c)
+		return nil
+	}))
+	sum, err := walkAll(opt)
+	werr, ok := err.(walk.Errors)
+	if (nil != err && !ok) || !sum.Changed() {
+		return sum, err
+	}
+	if perr := notify(url, Notice{Summary: sum, Changes: changes}); nil != perr {
+		if nil == err {
+			return sum, perr
+		}
+		return sum, append(werr, perr)
+	}
+	return sum, err
+}
+
+// merge returns a Taker whose handlers call the corresponding handler of the
+// given Taker a, if not nil, and then that of the given Taker b, if not nil.
+// The MovedFile handler is nil if that of a is nil, so that moves are reported
+// to b the same as they are reported to a, and likewise the AppendedFile
+// handlers. The Progress, Skipped, EnteredDir, and SkippedDir handlers of b are
+// never called.
+func merge(a, b Taker) Taker {
+	handler := func(x, y Handler) Handler {
+		if nil == x || nil == y {
+			if nil == x {
+				return y
+			}
+			return x
+		}
+		return func(filePath string) error {
+			if err := x(filePath); nil != err {
+				return err
+			}
+			return y(filePath)
+		}
+	}
+	withStatus := func(x, y StatusHandler) StatusHandler {
+		if nil == x || nil == y {
+			if nil == x {
+				return y
+			}
+			return x
+		}
+		return func(filePath string, old, new file.Status) error {
+			if err := x(filePath, old, new); nil != err {
+				return err
+			}
+			return y(filePath, old, new)
+		}
+	}
+	take := Taker{
+		NewFile:           handler(a.NewFile, b.NewFile),
+		ModFile:           handler(a.ModFile, b.ModFile),
+		DelFile:           handler(a.DelFile, b.DelFile),
+		BadFile:           handler(a.BadFile, b.BadFile),
+		Progress:          a.Progress,
+		Skipped:           a.Skipped,
+		EnteredDir:        a.EnteredDir,
+		SkippedDir:        a.SkippedDir,
+		NewFileWithStatus: withStatus(a.NewFileWithStatus, b.NewFileWithStatus),
+		ModFileWithStatus: withStatus(a.ModFileWithStatus, b.ModFileWithStatus),
+		DelFileWithStatus: withStatus(a.DelFileWithStatus, b.DelFileWithStatus),
+		BadFileWithStatus: withStatus(a.BadFileWithStatus, b.BadFileWithStatus),
+	}
+	if a.appends() {
+		take.AppendedFile = handler(a.AppendedFile, b.AppendedFile)
+		take.AppendedFileWithStatus = withStatus(a.AppendedFileWithStatus, b.AppendedFileWithStatus)
+	}
+	if nil != a.MovedFile {
+		take.MovedFile = a.MovedFile
+		if nil != b.MovedFile {
+			take.MovedFile = func(oldPath, newPath string) error {
+				if err := a.MovedFile(oldPath, newPath); nil != err {
+					return err
+				}
+				return b.MovedFile(oldPath, newPath)
+			}
+		}
+	}
+	return take
+}
+
+// notify posts the given Notice in JSON to the given URL, retrying with backoff
+// if the post fails (see WebhookRetries).
+func notify(url string, n Notice) error {
+	body, err := json.Marshal(n)
+	if nil != err {
+		return err
+	}
+	client := &http.Client{Timeout: WebhookTimeout}
+	wait := WebhookBackoff
+	for retry := 0; ; retry++ {
+		again, err := post(client, url, body)
+		if nil == err || !again || retry >= WebhookRetries {
+			return err
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// post posts the given JSON body to the given URL, and returns any error along
+// with whether or not the post may be retried.
+func post(client *http.Client, url string, body []byte) (bool, error) {
+	res, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if nil != err {
+		return true, err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		err := fmt.Errorf("webhook %s: %s", url, res.Status)
+		return res.StatusCode >= 500, err
+	}
+	return false, nil
+}